@@ -0,0 +1,155 @@
+package graphql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Args are the arguments of one selection of an Aliased field, they map argument names to their values
+type Args map[string]interface{}
+
+// Aliased selects the same field once for every set of arguments in a single request. Each selection is aliased
+// with the name of the field and its position, e.g. user0: user(id:$user0_id), and its arguments are sent as
+// variables of their own. The results are decoded back into out in the order of the argument sets. An Aliased is
+// passed to Query, or used as a field, in place of the struct that would hold the selections.
+type Aliased struct {
+	field  string
+	params string
+	out    reflect.Value
+	keys   []reflect.Value
+	args   []Args
+	err    error
+}
+
+// Each selects field for every set of arguments. out is a pointer to a slice, result i is the field selected with
+// argSets[i]. The selection of the field is built from the element type of the slice.
+func Each(field string, out interface{}, argSets []Args) *Aliased {
+	aliased := &Aliased{field: field, args: argSets}
+	aliased.out, aliased.err = outValue(out, reflect.Slice)
+	return aliased
+}
+
+// EachKeyed selects field for every set of arguments. out is a pointer to a map with string keys, the result for
+// a key is the field selected with the arguments of that key.
+func EachKeyed(field string, out interface{}, argSets map[string]Args) *Aliased {
+	aliased := &Aliased{field: field}
+	aliased.out, aliased.err = outValue(out, reflect.Map)
+	keys := make([]string, 0, len(argSets))
+	for key := range argSets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		aliased.keys = append(aliased.keys, reflect.ValueOf(key))
+		aliased.args = append(aliased.args, argSets[key])
+	}
+	if aliased.err == nil && aliased.out.Type().Key().Kind() != reflect.String {
+		aliased.err = fmt.Errorf("out should be a pointer to a map with string keys, got %s", aliased.out.Type())
+	}
+	return aliased
+}
+
+func outValue(out interface{}, kind reflect.Kind) (reflect.Value, error) {
+	val := reflect.ValueOf(out)
+	if val.Kind() != reflect.Ptr || val.IsNil() || val.Elem().Kind() != kind {
+		return reflect.Value{}, fmt.Errorf("out should be a pointer to a %s, got %T", kind, out)
+	}
+	return val.Elem(), nil
+}
+
+// Params declares the graphql types of the arguments with the syntax of gql_params, e.g. id:ID!,first:Int. The
+// types of arguments that are not declared are inferred from their values.
+func (a *Aliased) Params(params string) *Aliased {
+	a.params = params
+	return a
+}
+
+func (a *Aliased) alias(i int) string {
+	return fmt.Sprintf("%s%d", a.field, i)
+}
+
+// MarshalGql adds an aliased selection of the field for every set of arguments
+func (a *Aliased) MarshalGql(m *Marshaler) ([]*QueryPart, error) {
+	if a == nil {
+		return nil, errors.New("an Aliased selection can't be nil, create it with Each or EachKeyed")
+	}
+	if a.err != nil {
+		return nil, a.err
+	}
+	if a.field == "" {
+		return nil, errors.New("the field of an Aliased selection can't be empty")
+	}
+	types := map[string]string{}
+	if a.params != "" {
+		for _, param := range strings.Split(a.params, ",") {
+			parts := strings.SplitN(param, ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("param %q should be written as name:Type", param)
+			}
+			types[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	elemType := a.out.Type().Elem()
+	parts := []*QueryPart{}
+	for i, args := range a.args {
+		part := NewQueryPart(fmt.Sprintf("%s: %s", a.alias(i), a.field))
+		names := make([]string, 0, len(args))
+		for name := range args {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			variable := m.UniqueVariable(fmt.Sprintf("%s_%s", a.alias(i), name))
+			part.addVariableArgument(name, types[name], variable)
+			m.AddVariable(variable, args[name])
+		}
+		if err := m.marshal(elemType, reflect.New(elemType).Elem(), part); err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// UnmarshalJSON decodes the aliased results into out
+func (a *Aliased) UnmarshalJSON(data []byte) error {
+	if a.err != nil {
+		return a.err
+	}
+	if !a.out.IsValid() {
+		return errors.New("an Aliased selection must be created with Each or EachKeyed")
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	elemType := a.out.Type().Elem()
+	if a.out.Kind() == reflect.Slice {
+		a.out.Set(reflect.MakeSlice(a.out.Type(), len(a.args), len(a.args)))
+	} else if a.out.IsNil() {
+		a.out.Set(reflect.MakeMap(a.out.Type()))
+	}
+	for i := range a.args {
+		elem := reflect.New(elemType)
+		if raw, ok := fields[a.alias(i)]; ok {
+			if err := json.Unmarshal(raw, elem.Interface()); err != nil {
+				return err
+			}
+			if hasFragments(elemType) {
+				if err := fillFragments(raw, elem); err != nil {
+					return err
+				}
+			}
+		}
+		if a.out.Kind() == reflect.Slice {
+			a.out.Index(i).Set(elem.Elem())
+		} else {
+			a.out.SetMapIndex(a.keys[i].Convert(a.out.Type().Key()), elem.Elem())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package graphql
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type aliasedUser struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestAliasedQuery(t *testing.T) {
+	assert := assert.New(t)
+	users := []aliasedUser{}
+	req := newReq().Query(Each("user", &users, []Args{
+		{"id": ID("1")},
+		{"id": ID("2"), "lang": "en"},
+	}).Params("lang:Language"))
+	assert.Equal(`query($user0_id:ID!, $user1_id:ID!, $user1_lang:Language){
+    user0: user(id:$user0_id){
+        id
+        name
+    }
+    user1: user(id:$user1_id, lang:$user1_lang){
+        id
+        name
+    }
+}
+`, req.GetQuery())
+	assert.Equal(map[string]interface{}{"user0_id": ID("1"), "user1_id": ID("2"), "user1_lang": "en"}, req.GetVariables())
+}
+
+func TestAliasedDecodesInOrder(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body := graphqlRequest{}
+		assert.NoError(json.NewDecoder(req.Body).Decode(&body))
+		assert.Equal(map[string]interface{}{"user0_id": "a", "user1_id": "b", "user2_id": "c"}, body.Variables)
+		rw.Write([]byte(`{"data":{
+			"user2":{"id":"c","name":"Carol"},
+			"user0":{"id":"a","name":"Alice"},
+			"user1":null
+		}}`))
+	}))
+	defer server.Close()
+	users := []aliasedUser{}
+	_, err := NewClient(NewSimpleHTTPTransport(server.URL)).NewRequest().
+		Query(Each("user", &users, []Args{{"id": "a"}, {"id": "b"}, {"id": "c"}})).
+		Send()
+	assert.NoError(err)
+	assert.Equal([]aliasedUser{{ID: "a", Name: "Alice"}, {}, {ID: "c", Name: "Carol"}}, users)
+}
+
+func TestAliasedDecodesIntoMap(t *testing.T) {
+	assert := assert.New(t)
+	users := map[string]*aliasedUser{}
+	aliased := EachKeyed("user", &users, map[string]Args{"bob": {"id": "b"}, "alice": {"id": "a"}})
+	req := newReq().Query(aliased)
+	assert.Contains(req.GetQuery(), "user0: user(id:$user0_id)")
+	assert.Equal(map[string]interface{}{"user0_id": "a", "user1_id": "b"}, req.GetVariables())
+	assert.NoError(json.Unmarshal([]byte(`{"user0":{"name":"Alice"},"user1":{"name":"Bob"}}`), aliased))
+	assert.Equal("Alice", users["alice"].Name)
+	assert.Equal("Bob", users["bob"].Name)
+}
+
+func TestAliasedAsAField(t *testing.T) {
+	assert := assert.New(t)
+	users := []aliasedUser{}
+	query := &struct {
+		Viewer *Aliased `json:"viewer"`
+	}{Viewer: Each("friend", &users, []Args{{"id": "1"}})}
+	req := newReq().Query(query).WithVariable("friend0_id", "2")
+	assert.Contains(req.GetQuery(), "viewer{\n        friend0: friend(id:$friend0_id){")
+	assert.Equal("2", req.GetVariables()["friend0_id"])
+	_, err := unmarshalResponse([]byte(`{"data":{"viewer":{"friend0":{"id":"2"}}}}`), query)
+	assert.NoError(err)
+	assert.Equal([]aliasedUser{{ID: "2"}}, users)
+}
+
+func TestAliasedErrors(t *testing.T) {
+	assert := assert.New(t)
+	users := []aliasedUser{}
+	_, err := Marshal(Each("user", users, nil))
+	assert.EqualError(err, "out should be a pointer to a slice, got []graphql.aliasedUser")
+	_, err = Marshal(EachKeyed("user", &users, nil))
+	assert.Error(err)
+	_, err = Marshal(Each("user", &users, []Args{{"id": 1}}).Params("id"))
+	assert.EqualError(err, `param "id" should be written as name:Type`)
+}
+
+func TestAliasedVariablesDoNotClash(t *testing.T) {
+	assert := assert.New(t)
+	users, posts, admins := []aliasedUser{}, []aliasedUser{}, []aliasedUser{}
+	req := newReq().Query(&struct {
+		Users  *Aliased `json:"users"`
+		Posts  *Aliased `json:"posts"`
+		Admins *Aliased `json:"admins"`
+	}{
+		Users:  Each("user", &users, []Args{{"id": "1"}}),
+		Posts:  Each("post", &posts, []Args{{"id": "2"}}),
+		Admins: Each("user", &admins, []Args{{"id": "3"}}),
+	})
+	query := req.GetQuery()
+	assert.Contains(query, "user0: user(id:$user0_id)")
+	assert.Contains(query, "post0: post(id:$post0_id)")
+	assert.Contains(query, "user0: user(id:$user0_id2)")
+	assert.Equal(map[string]interface{}{"user0_id": "1", "post0_id": "2", "user0_id2": "3"}, req.GetVariables())
+}
+
+func TestNilAliased(t *testing.T) {
+	assert := assert.New(t)
+	req := newReq().Query(&struct {
+		Users *Aliased `json:"users"`
+	}{})
+	assert.EqualError(req.Err(), "Users: an Aliased selection can't be nil, create it with Each or EachKeyed")
+	assert.Error((&Aliased{}).UnmarshalJSON([]byte(`{}`)))
+}
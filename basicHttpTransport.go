@@ -2,22 +2,127 @@ package graphql
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
 )
 
-type gqlError struct {
-	Message string `json:"message"`
+const (
+	// defaultMaxGETURLLength is the longest url a query is sent with GET for, longer queries are POSTed
+	defaultMaxGETURLLength = 2048
+	// graphqlResponseContentType is the media type of graphql responses in the GraphQL over HTTP spec
+	graphqlResponseContentType = "application/graphql-response+json"
+)
+
+// StatusError is returned when the api responds with a status code that is not 2xx and the body is not a graphql
+// response with errors, or when it responds with a server error or says there were too many requests
+type StatusError struct {
+	// StatusCode is the status code of the response
+	StatusCode int
+	// Status is the status line of the response, e.g. "503 Service Unavailable"
+	Status string
 }
 
-func (g gqlError) Error() string {
-	return "graphql: " + g.Message
+func (s *StatusError) Error() string {
+	return fmt.Sprintf("error from the api: %s", s.Status)
 }
 
 type graphqlResponse struct {
 	Data   interface{} `json:"data"`
-	Errors []gqlError  `json:"errors"`
+	Errors Errors      `json:"errors"`
+}
+
+// graphqlRequest is the body sent to a graphql api for a single operation
+type graphqlRequest struct {
+	Query         string                 `json:"query,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// encodeGetURL encodes the body into the query string of apiURL so it can be sent with GET
+func encodeGetURL(apiURL string, body graphqlRequest) (string, error) {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return "", err
+	}
+	values := u.Query()
+	if body.Query != "" {
+		values.Set("query", body.Query)
+	}
+	if body.OperationName != "" {
+		values.Set("operationName", body.OperationName)
+	}
+	if len(body.Variables) > 0 {
+		variables, err := json.Marshal(body.Variables)
+		if err != nil {
+			return "", err
+		}
+		values.Set("variables", string(variables))
+	}
+	if len(body.Extensions) > 0 {
+		extensions, err := json.Marshal(body.Extensions)
+		if err != nil {
+			return "", err
+		}
+		values.Set("extensions", string(extensions))
+	}
+	u.RawQuery = values.Encode()
+	return u.String(), nil
+}
+
+func newGraphqlRequest(req Request) graphqlRequest {
+	return graphqlRequest{
+		Query:         req.GetQuery(),
+		OperationName: req.GetOperationName(),
+		Variables:     req.GetVariables(),
+	}
+}
+
+// unmarshalResponse decodes a graphql response payload into obj. The server can send data and errors at the same
+// time, so the decoded data is returned even when the response has errors. If the response has errors, all of
+// them are returned as Errors. The returned data is nil when the server sent no data. Inline fragments in obj are
+// filled from the branch matching the __typename of each object.
+func unmarshalResponse(payload []byte, obj interface{}) (interface{}, error) {
+	data := &graphqlResponse{
+		Data: obj,
+	}
+	if err := json.Unmarshal(payload, data); err != nil {
+		return nil, err
+	}
+	if data.Data != nil && hasFragments(reflect.TypeOf(data.Data)) {
+		raw := struct {
+			Data json.RawMessage `json:"data"`
+		}{}
+		if err := json.Unmarshal(payload, &raw); err != nil {
+			return nil, err
+		}
+		if err := fillFragments(raw.Data, reflect.ValueOf(data.Data)); err != nil {
+			return nil, err
+		}
+	}
+	if len(data.Errors) > 0 {
+		return data.Data, data.Errors
+	}
+	return data.Data, nil
+}
+
+// decode fills out the response from the payload of a graphql response
+func (r *Response) decode(payload []byte, obj interface{}) error {
+	var err error
+	r.Payload = payload
+	r.Response, err = unmarshalResponse(payload, obj)
+	r.Errors, _ = err.(Errors)
+	return err
 }
 
 // SimpleHTTPTransport is a simple http api that allows you to make a single request to headers
@@ -25,15 +130,119 @@ type graphqlResponse struct {
 type SimpleHTTPTransport struct {
 	apiURL  string
 	headers map[string][]string
+	client  *http.Client
+
+	getQueries      bool
+	maxGETURLLength int
+
+	persistedQueries  bool
+	persistedQueryGET bool
+	// queryHashes caches the sha256 hash of every query sent with persisted queries
+	queryHashes sync.Map
+	// persistedUnsupported is set once the api says it does not support persisted queries
+	persistedUnsupported bool
+	persistedLock        sync.RWMutex
 }
 
-// NewSimpleHTTPTransport takes the api URL and then returns a SimpleHttpTransport
-func NewSimpleHTTPTransport(apiURL string) *SimpleHTTPTransport {
+// HTTPOption configures a SimpleHTTPTransport. Options are applied in the order they are passed in.
+type HTTPOption func(*SimpleHTTPTransport)
+
+// WithHTTPClient sets the http client the transport sends requests with. By default every transport gets its own
+// client that behaves like http.DefaultClient. A nil client is replaced by a new default client.
+func WithHTTPClient(client *http.Client) HTTPOption {
+	return func(s *SimpleHTTPTransport) {
+		if client == nil {
+			client = &http.Client{}
+		}
+		s.client = client
+	}
+}
+
+// WithTimeout sets the timeout of the http client. The client is copied so a client passed to WithHTTPClient
+// is not changed.
+func WithTimeout(timeout time.Duration) HTTPOption {
+	return func(s *SimpleHTTPTransport) {
+		client := *s.client
+		client.Timeout = timeout
+		s.client = &client
+	}
+}
+
+// WithRoundTripper sets the http.RoundTripper of the http client, use this for instrumentation or to change how
+// connections are made. The client is copied so a client passed to WithHTTPClient is not changed.
+func WithRoundTripper(roundTripper http.RoundTripper) HTTPOption {
+	return func(s *SimpleHTTPTransport) {
+		client := *s.client
+		client.Transport = roundTripper
+		s.client = &client
+	}
+}
+
+// WithTLSConfig sets the TLS config used to connect to the API, for example to set up mTLS or custom root CAs.
+// If the client uses an *http.Transport it is cloned with the config, otherwise a clone of http.DefaultTransport
+// is used.
+func WithTLSConfig(config *tls.Config) HTTPOption {
+	return func(s *SimpleHTTPTransport) {
+		base, ok := s.client.Transport.(*http.Transport)
+		if !ok {
+			base = http.DefaultTransport.(*http.Transport)
+		}
+		roundTripper := base.Clone()
+		roundTripper.TLSClientConfig = config
+		WithRoundTripper(roundTripper)(s)
+	}
+}
+
+// WithHeader adds a header that is sent with every request
+func WithHeader(name string, value string) HTTPOption {
+	return func(s *SimpleHTTPTransport) {
+		s.AddHeader(name, value)
+	}
+}
+
+// WithGETQueries sends queries with GET following the GraphQL over HTTP spec, so they can be cached. Mutations and
+// queries whose url would be longer than maxURLLength are sent with POST. A maxURLLength of zero or less uses a
+// default of 2048.
+func WithGETQueries(maxURLLength int) HTTPOption {
+	return func(s *SimpleHTTPTransport) {
+		if maxURLLength <= 0 {
+			maxURLLength = defaultMaxGETURLLength
+		}
+		s.getQueries = true
+		s.maxGETURLLength = maxURLLength
+	}
+}
+
+// WithPersistedQueries turns on automatic persisted queries. The transport first sends only the sha256 hash of the
+// query, and when the api does not know the hash yet it sends the full query so the api can store it.
+func WithPersistedQueries() HTTPOption {
+	return func(s *SimpleHTTPTransport) {
+		s.persistedQueries = true
+	}
+}
+
+// WithPersistedQueryGET turns on automatic persisted queries and sends the hashed queries with GET so they can be
+// cached by CDNs. Mutations and the requests that send the full query are always sent with POST.
+func WithPersistedQueryGET() HTTPOption {
+	return func(s *SimpleHTTPTransport) {
+		s.persistedQueries = true
+		s.persistedQueryGET = true
+	}
+}
+
+// NewSimpleHTTPTransport takes the api URL and then returns a SimpleHttpTransport. Options can be passed to
+// configure the http client of the transport.
+func NewSimpleHTTPTransport(apiURL string, opts ...HTTPOption) *SimpleHTTPTransport {
 	transport := &SimpleHTTPTransport{
 		apiURL:  apiURL,
 		headers: map[string][]string{},
+		client:  &http.Client{},
 	}
 	transport.AddHeader("Content-Type", "application/json")
+	transport.AddHeader("Accept", graphqlResponseContentType+", application/json;q=0.9")
+	for _, opt := range opts {
+		opt(transport)
+	}
 	return transport
 }
 
@@ -49,28 +258,191 @@ func (s *SimpleHTTPTransport) AddHeader(name string, value string) {
 
 // Transport the request to the API
 func (s *SimpleHTTPTransport) Transport(req Request) (Response, error) {
-	// for  key, value := range req.GetVariables() {
-	// 	gqlReq.Var(key, value)
-	// }
-	response := Response{}
-	bts, err := json.Marshal(struct {
-		Query    string                 `json:"query"`
-		Variable map[string]interface{} `json:"variables"`
-	}{
-		Query:    req.GetQuery(),
-		Variable: req.GetVariables(),
-	})
+	return s.TransportContext(context.Background(), req)
+}
+
+// TransportContext transports the request to the API, the context is attached to the outgoing http request
+func (s *SimpleHTTPTransport) TransportContext(ctx context.Context, req Request) (Response, error) {
+	body := newGraphqlRequest(req)
+	if uploads := collectUploads(body.Variables); len(uploads) > 0 {
+		return s.sendMultipart(ctx, req, body, uploads)
+	}
+	if s.persistedQueries && !s.isPersistedUnsupported() {
+		return s.sendPersisted(ctx, req, body)
+	}
+	return s.send(ctx, req, body, s.canUseGET(req, body))
+}
+
+// canUseGET reports whether the request is a query that can be sent with GET
+func (s *SimpleHTTPTransport) canUseGET(req Request, body graphqlRequest) bool {
+	if !s.getQueries || req.GetOperationType() != "query" {
+		return false
+	}
+	getURL, err := encodeGetURL(s.apiURL, body)
+	return err == nil && len(getURL) <= s.maxGETURLLength
+}
+
+// sendPersisted sends the hash of the query and falls back to sending the full query if the api does not know it
+func (s *SimpleHTTPTransport) sendPersisted(ctx context.Context, req Request, body graphqlRequest) (Response, error) {
+	body.Extensions = map[string]interface{}{
+		"persistedQuery": map[string]interface{}{
+			"version":    1,
+			"sha256Hash": s.queryHash(body.Query),
+		},
+	}
+	hashed := body
+	hashed.Query = ""
+	useGET := s.persistedQueryGET && req.GetOperationType() != "mutation"
+	response, err := s.send(ctx, req, hashed, useGET)
+	switch {
+	case response.Errors.HasCode("PERSISTED_QUERY_NOT_FOUND") || hasMessage(response.Errors, "PersistedQueryNotFound"):
+		return s.send(ctx, req, body, false)
+	case response.Errors.HasCode("PERSISTED_QUERY_NOT_SUPPORTED") || hasMessage(response.Errors, "PersistedQueryNotSupported"):
+		s.persistedLock.Lock()
+		s.persistedUnsupported = true
+		s.persistedLock.Unlock()
+		body.Extensions = nil
+		return s.send(ctx, req, body, false)
+	}
+	return response, err
+}
+
+func (s *SimpleHTTPTransport) isPersistedUnsupported() bool {
+	s.persistedLock.RLock()
+	defer s.persistedLock.RUnlock()
+	return s.persistedUnsupported
+}
+
+// queryHash returns the hex encoded sha256 hash of the query
+func (s *SimpleHTTPTransport) queryHash(query string) string {
+	if hash, ok := s.queryHashes.Load(query); ok {
+		return hash.(string)
+	}
+	sum := sha256.Sum256([]byte(query))
+	hash := hex.EncodeToString(sum[:])
+	s.queryHashes.Store(query, hash)
+	return hash
+}
+
+func hasMessage(errs Errors, message string) bool {
+	for _, err := range errs {
+		if err.Message == message {
+			return true
+		}
+	}
+	return false
+}
+
+// TransportBatch sends all of the requests to the API in one http request. The body is a json list of the
+// operations and the api responds with a list of results in the same order. Requests with uploads can't be part of
+// a json list, they are sent on their own as multipart requests.
+func (s *SimpleHTTPTransport) TransportBatch(ctx context.Context, reqs []Request) ([]BatchResult, error) {
+	results := make([]BatchResult, len(reqs))
+	batched := []Request{}
+	bodies := []graphqlRequest{}
+	positions := []int{}
+	for i, req := range reqs {
+		body := newGraphqlRequest(req)
+		if uploads := collectUploads(body.Variables); len(uploads) > 0 {
+			results[i].Response, results[i].Err = s.sendMultipart(ctx, req, body, uploads)
+			continue
+		}
+		batched = append(batched, req)
+		bodies = append(bodies, body)
+		positions = append(positions, i)
+	}
+	if len(batched) == 0 {
+		return results, nil
+	}
+	sent, err := s.postBatch(ctx, batched, bodies)
 	if err != nil {
-		return response, err
+		return nil, err
+	}
+	for i, result := range sent {
+		results[positions[i]] = result
 	}
-	httpReq, err := http.NewRequest("POST", s.apiURL, bytes.NewBuffer(bts))
-	for key, value := range s.headers {
-		for _, headerVal := range value {
-			httpReq.Header.Add(key, headerVal)
+	return results, nil
+}
+
+// postBatch posts the bodies of the requests as a json list and decodes the results into the requests
+func (s *SimpleHTTPTransport) postBatch(ctx context.Context, reqs []Request, bodies []graphqlRequest) ([]BatchResult, error) {
+	bts, err := json.Marshal(bodies)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", s.apiURL, bytes.NewBuffer(bts))
+	if err != nil {
+		return nil, err
+	}
+	addHeaders(httpReq, s.headers)
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	bf := bytes.Buffer{}
+	if _, err = bf.ReadFrom(resp.Body); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	payloads := []json.RawMessage{}
+	if err := json.Unmarshal(bf.Bytes(), &payloads); err != nil {
+		// apis that do not support batching usually answer with a single error response
+		single := graphqlResponse{}
+		if json.Unmarshal(bf.Bytes(), &single) == nil && len(single.Errors) > 0 {
+			return nil, single.Errors
+		}
+		return nil, err
+	}
+	if len(payloads) != len(reqs) {
+		return nil, fmt.Errorf("graphql: sent %d operations in a batch but got %d results", len(reqs), len(payloads))
+	}
+	results := make([]BatchResult, len(reqs))
+	for i, req := range reqs {
+		results[i].Response = Response{
+			HttpRequest:  httpReq,
+			HttpResponse: resp,
+		}
+		results[i].Err = results[i].Response.decode(payloads[i], req.GetInterface())
+	}
+	return results, nil
+}
+
+// send sends the body to the api, as a query string when useGET is set and as a json body otherwise
+func (s *SimpleHTTPTransport) send(ctx context.Context, req Request, body graphqlRequest, useGET bool) (Response, error) {
+	response := Response{}
+	var httpReq *http.Request
+	if useGET {
+		getURL, err := encodeGetURL(s.apiURL, body)
+		if err != nil {
+			return response, err
+		}
+		if httpReq, err = http.NewRequestWithContext(ctx, "GET", getURL, nil); err != nil {
+			return response, err
+		}
+	} else {
+		bts, err := json.Marshal(body)
+		if err != nil {
+			return response, err
+		}
+		if httpReq, err = http.NewRequestWithContext(ctx, "POST", s.apiURL, bytes.NewBuffer(bts)); err != nil {
+			return response, err
 		}
 	}
+	addHeaders(httpReq, s.headers)
+	if useGET {
+		httpReq.Header.Del("Content-Type")
+	}
+	return s.do(req, httpReq)
+}
+
+// do sends the http request and decodes the response into the object of the request
+func (s *SimpleHTTPTransport) do(req Request, httpReq *http.Request) (Response, error) {
+	response := Response{}
 	response.HttpRequest = httpReq
-	resp, err := http.DefaultClient.Do(httpReq)
+	resp, err := s.client.Do(httpReq)
 	if err != nil {
 		return response, err
 	}
@@ -81,19 +453,26 @@ func (s *SimpleHTTPTransport) Transport(req Request) (Response, error) {
 		return response, err
 	}
 	response.Payload = bf.Bytes()
-	if resp.StatusCode == 500 {
-		return response, fmt.Errorf("error from the api: %s", resp.Status)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return response, response.decodeFailed(req.GetInterface())
 	}
-	data := &graphqlResponse{
-		Data: req.GetInterface(),
-	}
-	err = json.Unmarshal(response.Payload, data)
-	if err != nil {
-		return response, err
+	return response, response.decode(response.Payload, req.GetInterface())
+}
+
+// decodeFailed decodes a response with a status code that is not 2xx. Following the GraphQL over HTTP spec, a
+// application/graphql-response+json body is a graphql response whose errors say why the request failed. Older
+// servers answering with application/json can also send graphql errors with a 4xx status. Anything else is
+// returned as a StatusError.
+func (r *Response) decodeFailed(obj interface{}) error {
+	resp := r.HttpResponse
+	statusErr := &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	isGraphqlResponse := strings.HasPrefix(resp.Header.Get("Content-Type"), graphqlResponseContentType)
+	if !isGraphqlResponse && (resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests) {
+		return statusErr
 	}
-	if len(data.Errors) > 0 {
-		return response, data.Errors[0]
+	if err := r.decode(r.Payload, obj); len(r.Errors) > 0 {
+		return err
 	}
-	response.Response = data.Data
-	return response, nil
+	r.Response = nil
+	return statusErr
 }
@@ -2,10 +2,14 @@ package graphql
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -24,7 +28,7 @@ type testRep struct {
 			Message string `json:"message"`
 		} `json:"sub_query"`
 	} `json:"data"`
-	Error []gqlError `json:"errors"`
+	Error Errors `json:"errors"`
 }
 
 type reqObj struct {
@@ -177,7 +181,7 @@ func TestHandlesErrorsRight(t *testing.T) {
 
 		// Send response to be tested
 		resp := testRep{}
-		resp.Error = []gqlError{
+		resp.Error = Errors{
 			{
 				Message: "some_error",
 			},
@@ -195,3 +199,402 @@ func TestHandlesErrorsRight(t *testing.T) {
 	assert.Equal("graphql: some_error", err.Error())
 	assert.True(wasCalled)
 }
+
+func TestCancelsWithContext(t *testing.T) {
+	assert := assert.New(t)
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+	transport := NewSimpleHTTPTransport(server.URL)
+	msg := &testQuery{}
+	req := newReq().Query(msg)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	resp, err := transport.TransportContext(ctx, req)
+	assert.Error(err)
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(ctx, resp.HttpRequest.Context())
+}
+
+func TestReturnsAllErrors(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`{
+			"data": null,
+			"errors": [
+				{
+					"message": "not logged in",
+					"locations": [{"line": 2, "column": 3}],
+					"path": ["sub_query", 0, "message"],
+					"extensions": {"code": "UNAUTHENTICATED"}
+				},
+				{"message": "something else"}
+			]
+		}`))
+	}))
+	defer server.Close()
+	transport := NewSimpleHTTPTransport(server.URL)
+	_, err := transport.Transport(newReq().Query(&testQuery{}))
+	assert.EqualError(err, "graphql: not logged in; something else")
+
+	errs := Errors{}
+	assert.True(errors.As(err, &errs))
+	assert.Len(errs, 2)
+	assert.Equal([]Location{{Line: 2, Column: 3}}, errs[0].Locations)
+	assert.Equal([]interface{}{"sub_query", float64(0), "message"}, errs[0].Path)
+	assert.Equal("UNAUTHENTICATED", errs[0].Code())
+	assert.Len(errs.ByCode("UNAUTHENTICATED"), 1)
+
+	first := Error{}
+	assert.True(errors.As(err, &first))
+	assert.Equal("not logged in", first.Message)
+	assert.True(errors.Is(err, Error{Extensions: map[string]interface{}{"code": "UNAUTHENTICATED"}}))
+	assert.False(errors.Is(err, Error{Extensions: map[string]interface{}{"code": "FORBIDDEN"}}))
+}
+
+func TestReturnsPartialData(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`{
+			"data": {"message": "Good", "sub_query": null},
+			"errors": [{"message": "could not resolve", "path": ["sub_query"]}]
+		}`))
+	}))
+	defer server.Close()
+	transport := NewSimpleHTTPTransport(server.URL)
+	msg := &testQuery{}
+	resp, err := transport.Transport(newReq().Query(msg))
+	assert.EqualError(err, "graphql: could not resolve")
+	assert.Equal("Good", msg.Message)
+	assert.Equal(msg, resp.Response)
+	assert.Len(resp.Errors, 1)
+	assert.Equal([]string{"sub_query"}, resp.Errors.Paths())
+	assert.Len(resp.Errors.ForPath("sub_query"), 1)
+	assert.Empty(resp.Errors.ForPath("message"))
+}
+
+func TestNullDataIsNotReturned(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`{"data": null, "errors": [{"message": "bad query"}]}`))
+	}))
+	defer server.Close()
+	transport := NewSimpleHTTPTransport(server.URL)
+	resp, err := transport.Transport(newReq().Query(&testQuery{}))
+	assert.Error(err)
+	assert.Nil(resp.Response)
+	assert.Len(resp.Errors, 1)
+}
+
+type countingRoundTripper struct {
+	calls int
+}
+
+func (c *countingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.calls++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func okServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`{"data":{"message":"Good"}}`))
+	}))
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	assert := assert.New(t)
+	server := okServer()
+	defer server.Close()
+	roundTripper := &countingRoundTripper{}
+	client := &http.Client{Transport: roundTripper}
+	transport := NewSimpleHTTPTransport(server.URL, WithHTTPClient(client), WithTimeout(time.Second))
+	_, err := transport.Transport(newReq().Query(&testQuery{}))
+	assert.NoError(err)
+	assert.Equal(1, roundTripper.calls)
+	assert.Equal(time.Second, transport.client.Timeout)
+	assert.Equal(time.Duration(0), client.Timeout)
+}
+
+func TestWithNilHTTPClient(t *testing.T) {
+	assert := assert.New(t)
+	server := okServer()
+	defer server.Close()
+	roundTripper := &countingRoundTripper{}
+	transport := NewSimpleHTTPTransport(server.URL, WithHTTPClient(nil), WithTimeout(time.Second), WithRoundTripper(roundTripper))
+	_, err := transport.Transport(newReq().Query(&testQuery{}))
+	assert.NoError(err)
+	assert.Equal(1, roundTripper.calls)
+	assert.Equal(time.Second, transport.client.Timeout)
+}
+
+func TestWithRoundTripper(t *testing.T) {
+	assert := assert.New(t)
+	server := okServer()
+	defer server.Close()
+	roundTripper := &countingRoundTripper{}
+	transport := NewSimpleHTTPTransport(server.URL, WithRoundTripper(roundTripper))
+	other := NewSimpleHTTPTransport(server.URL)
+	transport.Transport(newReq().Query(&testQuery{}))
+	other.Transport(newReq().Query(&testQuery{}))
+	assert.Equal(1, roundTripper.calls)
+	assert.True(transport.client != other.client)
+	assert.True(other.client != http.DefaultClient)
+}
+
+func TestWithTimeout(t *testing.T) {
+	assert := assert.New(t)
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+	transport := NewSimpleHTTPTransport(server.URL, WithTimeout(20*time.Millisecond))
+	_, err := transport.Transport(newReq().Query(&testQuery{}))
+	assert.Error(err)
+}
+
+func TestWithTLSConfig(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`{"data":{"message":"Good"}}`))
+	}))
+	defer server.Close()
+	_, err := NewSimpleHTTPTransport(server.URL).Transport(newReq().Query(&testQuery{}))
+	assert.Error(err)
+
+	config := server.Client().Transport.(*http.Transport).TLSClientConfig
+	msg := &testQuery{}
+	transport := NewSimpleHTTPTransport(server.URL, WithTLSConfig(config), WithHeader("X-Test", "1"))
+	_, err = transport.Transport(newReq().Query(msg))
+	assert.NoError(err)
+	assert.Equal("Good", msg.Message)
+	assert.Equal([]string{"1"}, transport.headers["X-Test"])
+}
+
+type apqServer struct {
+	known     map[string]string
+	methods   []string
+	hadQuery  []bool
+	supported bool
+}
+
+func (a *apqServer) handler(t *testing.T) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		body := graphqlRequest{}
+		if req.Method == "GET" {
+			body.Query = req.URL.Query().Get("query")
+			if extensions := req.URL.Query().Get("extensions"); extensions != "" {
+				assert.NoError(t, json.Unmarshal([]byte(extensions), &body.Extensions))
+			}
+		} else {
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+		}
+		a.methods = append(a.methods, req.Method)
+		a.hadQuery = append(a.hadQuery, body.Query != "")
+		if !a.supported {
+			if body.Query == "" {
+				rw.Write([]byte(`{"errors":[{"message":"PersistedQueryNotSupported"}]}`))
+				return
+			}
+			rw.Write([]byte(`{"data":{"message":"Good"}}`))
+			return
+		}
+		persisted := body.Extensions["persistedQuery"].(map[string]interface{})
+		hash := persisted["sha256Hash"].(string)
+		if body.Query == "" {
+			if _, ok := a.known[hash]; !ok {
+				rw.Write([]byte(`{"errors":[{"message":"PersistedQueryNotFound","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]}`))
+				return
+			}
+		} else {
+			a.known[hash] = body.Query
+		}
+		rw.Write([]byte(`{"data":{"message":"Good"}}`))
+	}
+}
+
+func TestPersistedQueries(t *testing.T) {
+	assert := assert.New(t)
+	apq := &apqServer{known: map[string]string{}, supported: true}
+	server := httptest.NewServer(apq.handler(t))
+	defer server.Close()
+	transport := NewSimpleHTTPTransport(server.URL, WithPersistedQueries())
+
+	msg := &testQuery{}
+	_, err := transport.Transport(newReq().Query(msg))
+	assert.NoError(err)
+	assert.Equal("Good", msg.Message)
+	assert.Equal([]bool{false, true}, apq.hadQuery)
+	assert.Len(apq.known, 1)
+	for hash, query := range apq.known {
+		assert.Equal(transport.queryHash(query), hash)
+		assert.Len(hash, 64)
+	}
+
+	msg = &testQuery{}
+	_, err = transport.Transport(newReq().Query(msg))
+	assert.NoError(err)
+	assert.Equal("Good", msg.Message)
+	assert.Equal([]bool{false, true, false}, apq.hadQuery)
+	assert.Equal([]string{"POST", "POST", "POST"}, apq.methods)
+}
+
+func TestPersistedQueriesWithGET(t *testing.T) {
+	assert := assert.New(t)
+	apq := &apqServer{known: map[string]string{}, supported: true}
+	server := httptest.NewServer(apq.handler(t))
+	defer server.Close()
+	transport := NewSimpleHTTPTransport(server.URL, WithPersistedQueryGET())
+
+	_, err := transport.Transport(newReq().Query(&testQuery{}))
+	assert.NoError(err)
+	_, err = transport.Transport(newReq().Query(&testQuery{}))
+	assert.NoError(err)
+	assert.Equal([]string{"GET", "POST", "GET"}, apq.methods)
+
+	_, err = transport.Transport(newReq().Mutation(&testQuery{}))
+	assert.NoError(err)
+	assert.Equal("POST", apq.methods[3])
+}
+
+func TestPersistedQueriesNotSupported(t *testing.T) {
+	assert := assert.New(t)
+	apq := &apqServer{}
+	server := httptest.NewServer(apq.handler(t))
+	defer server.Close()
+	transport := NewSimpleHTTPTransport(server.URL, WithPersistedQueries())
+
+	msg := &testQuery{}
+	_, err := transport.Transport(newReq().Query(msg))
+	assert.NoError(err)
+	assert.Equal("Good", msg.Message)
+	_, err = transport.Transport(newReq().Query(&testQuery{}))
+	assert.NoError(err)
+	assert.Equal([]bool{false, true, true}, apq.hadQuery)
+}
+
+func TestEncodeGetURL(t *testing.T) {
+	assert := assert.New(t)
+	getURL, err := encodeGetURL("https://example.com/graphql?key=1", graphqlRequest{
+		Query:      "query{a}",
+		Variables:  map[string]interface{}{"id": "1"},
+		Extensions: map[string]interface{}{"persistedQuery": map[string]interface{}{"version": 1}},
+	})
+	assert.NoError(err)
+	parsed, err := url.Parse(getURL)
+	assert.NoError(err)
+	assert.Equal("1", parsed.Query().Get("key"))
+	assert.Equal("query{a}", parsed.Query().Get("query"))
+	assert.JSONEq(`{"id":"1"}`, parsed.Query().Get("variables"))
+	assert.JSONEq(`{"persistedQuery":{"version":1}}`, parsed.Query().Get("extensions"))
+
+	getURL, err = encodeGetURL("https://example.com/graphql", graphqlRequest{Query: "query{a}"})
+	assert.NoError(err)
+	assert.Equal("https://example.com/graphql?query=query%7Ba%7D", getURL)
+}
+
+func TestSendsQueriesWithGET(t *testing.T) {
+	assert := assert.New(t)
+	methods := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		methods = append(methods, req.Method)
+		if req.Method == "GET" {
+			assert.Empty(req.Header.Get("Content-Type"))
+			assert.Contains(req.URL.Query().Get("query"), "sub_query(name:$name)")
+			assert.JSONEq(`{"name":"someName"}`, req.URL.Query().Get("variables"))
+		}
+		rw.Header().Set("Content-Type", graphqlResponseContentType)
+		rw.Write([]byte(`{"data":{"message":"Good"}}`))
+	}))
+	defer server.Close()
+	transport := NewSimpleHTTPTransport(server.URL, WithGETQueries(0))
+	msg := &testQuery{}
+	_, err := transport.Transport(newReq().Query(msg).WithVariable("name", "someName"))
+	assert.NoError(err)
+	assert.Equal("Good", msg.Message)
+
+	_, err = transport.Transport(newReq().Mutation(&testQuery{}))
+	assert.NoError(err)
+
+	short := NewSimpleHTTPTransport(server.URL, WithGETQueries(len(server.URL)+10))
+	_, err = short.Transport(newReq().Query(&testQuery{}))
+	assert.NoError(err)
+	assert.Equal([]string{"GET", "POST", "POST"}, methods)
+}
+
+func TestSendsAcceptHeader(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal("application/graphql-response+json, application/json;q=0.9", req.Header.Get("Accept"))
+		rw.Write([]byte(`{"data":{"message":"Good"}}`))
+	}))
+	defer server.Close()
+	_, err := NewSimpleHTTPTransport(server.URL).Transport(newReq().Query(&testQuery{}))
+	assert.NoError(err)
+}
+
+func TestStatusCodeSemantics(t *testing.T) {
+	cases := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		graphqlErr  bool
+	}{
+		{"graphql response with bad request", 400, graphqlResponseContentType, `{"errors":[{"message":"parse error"}]}`, true},
+		{"graphql response with server error", 500, graphqlResponseContentType, `{"errors":[{"message":"boom"}]}`, true},
+		{"json with bad request", 400, "application/json", `{"errors":[{"message":"parse error"}]}`, true},
+		{"json with server error", 500, "application/json", `{"errors":[{"message":"boom"}]}`, false},
+		{"html with bad request", 400, "text/html", `<html></html>`, false},
+		{"graphql response without errors", 404, graphqlResponseContentType, `{}`, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Set("Content-Type", c.contentType)
+				rw.WriteHeader(c.status)
+				rw.Write([]byte(c.body))
+			}))
+			defer server.Close()
+			resp, err := NewSimpleHTTPTransport(server.URL).Transport(newReq().Query(&testQuery{}))
+			assert.Error(err)
+			errs := Errors{}
+			statusErr := &StatusError{}
+			if c.graphqlErr {
+				assert.True(errors.As(err, &errs))
+				assert.Len(resp.Errors, 1)
+				return
+			}
+			assert.True(errors.As(err, &statusErr))
+			assert.Equal(c.status, statusErr.StatusCode)
+			assert.Nil(resp.Response)
+		})
+	}
+}
+
+func TestSendsOperationName(t *testing.T) {
+	assert := assert.New(t)
+	names := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method == "GET" {
+			names = append(names, req.URL.Query().Get("operationName"))
+		} else {
+			body := graphqlRequest{}
+			assert.NoError(json.NewDecoder(req.Body).Decode(&body))
+			assert.Contains(body.Query, "query GetMessage{")
+			names = append(names, body.OperationName)
+		}
+		rw.Write([]byte(`{"data":{"message":"Good"}}`))
+	}))
+	defer server.Close()
+	_, err := NewSimpleHTTPTransport(server.URL).Transport(newReq().Query(&testQuery{}).Named("GetMessage"))
+	assert.NoError(err)
+	_, err = NewSimpleHTTPTransport(server.URL, WithGETQueries(0)).Transport(newReq().Query(&testQuery{}).Named("GetMessage"))
+	assert.NoError(err)
+	assert.Equal([]string{"GetMessage", "GetMessage"}, names)
+}
@@ -0,0 +1,280 @@
+package graphql
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BatchResult is the outcome of a single request in a batch
+type BatchResult struct {
+	// Response is the response for the request
+	Response Response
+	// Err is the error for the request, graphql errors for one request do not fail the rest of the batch
+	Err error
+}
+
+// BatchTransport is a Transport that can send many requests in a single round trip
+type BatchTransport interface {
+	// TransportBatch sends all of the requests at once. The results are in the same order as reqs. The error is
+	// set when the batch as a whole failed.
+	TransportBatch(ctx context.Context, reqs []Request) ([]BatchResult, error)
+}
+
+// sendBatch sends the requests with transport as a batch if it implements BatchTransport, otherwise they are sent
+// one after the other
+func sendBatch(ctx context.Context, transport Transport, reqs []Request) ([]BatchResult, error) {
+	if t, ok := transport.(BatchTransport); ok {
+		return t.TransportBatch(ctx, reqs)
+	}
+	results := make([]BatchResult, len(reqs))
+	for i, req := range reqs {
+		results[i].Response, results[i].Err = req.SendContext(ctx)
+	}
+	return results, nil
+}
+
+type pendingRequest struct {
+	req Request
+	// headers are the headers on the context the request was sent with
+	headers http.Header
+	result  chan BatchResult
+}
+
+func newPendingRequest(ctx context.Context, req Request) *pendingRequest {
+	return &pendingRequest{req: req, headers: headersFromContext(ctx), result: make(chan BatchResult, 1)}
+}
+
+// sendPending sends the pending requests with next and hands them their results. Requests carrying different
+// headers, e.g. from Headers or ContextWithHeaders, are sent in separate batches so each batch is sent with the
+// headers of its own requests. It returns the error of a batch that failed as a whole.
+func sendPending(ctx context.Context, next BatchTransport, batch []*pendingRequest) error {
+	groups := map[string][]*pendingRequest{}
+	keys := []string{}
+	for _, pending := range batch {
+		key := headerSetKey(pending.headers)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], pending)
+	}
+	var batchErr error
+	for _, key := range keys {
+		group := groups[key]
+		reqs := make([]Request, len(group))
+		for i, pending := range group {
+			reqs[i] = pending.req
+		}
+		results, err := next.TransportBatch(context.WithValue(ctx, headersKey{}, group[0].headers), reqs)
+		if err != nil {
+			batchErr = err
+		}
+		for i, pending := range group {
+			if err != nil {
+				pending.result <- BatchResult{Err: err}
+				continue
+			}
+			pending.result <- results[i]
+		}
+	}
+	return batchErr
+}
+
+// headerSetKey returns a string that is the same for equal sets of headers
+func headerSetKey(headers http.Header) string {
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	builder := &strings.Builder{}
+	for _, key := range keys {
+		builder.WriteString(key + "\x00" + strings.Join(headers[key], "\x00") + "\x01")
+	}
+	return builder.String()
+}
+
+// BatchingTransport coalesces the requests sent through it within a time window into a single batch. This lets
+// concurrent Send calls share one round trip without changing the code that makes them.
+type BatchingTransport struct {
+	next    BatchTransport
+	window  time.Duration
+	maxSize int
+
+	lock    sync.Mutex
+	pending []*pendingRequest
+	timer   *time.Timer
+}
+
+// NewBatchingTransport returns a transport that waits up to window after the first request of a batch for more
+// requests before sending them all with next. A batch is sent right away once it has maxSize requests, a maxSize
+// of zero or less means batches are only limited by the window.
+func NewBatchingTransport(next BatchTransport, window time.Duration, maxSize int) *BatchingTransport {
+	return &BatchingTransport{
+		next:    next,
+		window:  window,
+		maxSize: maxSize,
+	}
+}
+
+// Transport adds the request to the current batch and waits for its result
+func (b *BatchingTransport) Transport(req Request) (Response, error) {
+	return b.TransportContext(context.Background(), req)
+}
+
+// TransportContext adds the request to the current batch and waits for its result. When the context is done the
+// request stops waiting, but it is still sent as part of the batch. The headers on the context are sent with the
+// request, requests with different headers are sent in different batches.
+func (b *BatchingTransport) TransportContext(ctx context.Context, req Request) (Response, error) {
+	pending := newPendingRequest(ctx, req)
+	b.lock.Lock()
+	b.pending = append(b.pending, pending)
+	if b.maxSize > 0 && len(b.pending) >= b.maxSize {
+		b.flushLocked()
+	} else if len(b.pending) == 1 {
+		b.timer = time.AfterFunc(b.window, b.flush)
+	}
+	b.lock.Unlock()
+
+	select {
+	case result := <-pending.result:
+		return result.Response, result.Err
+	case <-ctx.Done():
+		return Response{}, ctx.Err()
+	}
+}
+
+func (b *BatchingTransport) flush() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.flushLocked()
+}
+
+// flushLocked sends the pending requests, the lock must be held
+func (b *BatchingTransport) flushLocked() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	batch := b.pending
+	b.pending = nil
+	if len(batch) == 0 {
+		return
+	}
+	go sendPending(context.Background(), b.next, batch)
+}
+
+type batchSlotKey struct{}
+
+// batchSlot tracks a request of a batch sent by a client while it goes through the middlewares
+type batchSlot struct {
+	reached bool
+}
+
+// batchCollectWindow is how long a batch sent by a client waits for requests still going through the middlewares
+// after the first request reached the transport
+const batchCollectWindow = 10 * time.Millisecond
+
+// batchCollector is the transport the middlewares of a client wrap when the client sends a batch. It holds the
+// requests that make it through the middlewares until every request of the batch either reached it or returned
+// without it, then sends them together. Middlewares can hold a request back until another one returns, like one
+// limiting concurrency does, so the batch is also sent batchCollectWindow after the first request reached it. A
+// request that reaches it after the batch was sent, e.g. when it is retried, is sent alone.
+type batchCollector struct {
+	ctx  context.Context
+	base Transport
+	next BatchTransport
+
+	lock      sync.Mutex
+	remaining int
+	pending   []*pendingRequest
+	timer     *time.Timer
+	sent      bool
+	err       error
+	done      chan struct{}
+}
+
+func newBatchCollector(ctx context.Context, base Transport, next BatchTransport, size int) *batchCollector {
+	return &batchCollector{ctx: ctx, base: base, next: next, remaining: size, done: make(chan struct{})}
+}
+
+// Transport adds the request to the batch and waits for its result
+func (b *batchCollector) Transport(req Request) (Response, error) {
+	return b.TransportContext(context.Background(), req)
+}
+
+// TransportContext adds the request to the batch and waits for its result
+func (b *batchCollector) TransportContext(ctx context.Context, req Request) (Response, error) {
+	slot, _ := ctx.Value(batchSlotKey{}).(*batchSlot)
+	b.lock.Lock()
+	if b.sent || slot == nil || slot.reached {
+		b.lock.Unlock()
+		return TransportWithContext(ctx, b.base, req)
+	}
+	slot.reached = true
+	pending := newPendingRequest(ctx, req)
+	b.pending = append(b.pending, pending)
+	b.remaining--
+	if b.timer == nil {
+		b.timer = time.AfterFunc(batchCollectWindow, b.flush)
+	}
+	b.flushIfReadyLocked()
+	b.lock.Unlock()
+
+	select {
+	case result := <-pending.result:
+		return result.Response, result.Err
+	case <-ctx.Done():
+		return Response{}, ctx.Err()
+	}
+}
+
+// send sends req through transport, which wraps the collector, as part of the batch
+func (b *batchCollector) send(transport Transport, req Request) (Response, error) {
+	slot := &batchSlot{}
+	resp, err := TransportWithContext(context.WithValue(b.ctx, batchSlotKey{}, slot), transport, req)
+	b.lock.Lock()
+	if !slot.reached {
+		slot.reached = true
+		b.remaining--
+		b.flushIfReadyLocked()
+	}
+	b.lock.Unlock()
+	return resp, err
+}
+
+// flushIfReadyLocked sends the batch once no request is left going through the middlewares, the lock must be held
+func (b *batchCollector) flushIfReadyLocked() {
+	if b.remaining > 0 {
+		return
+	}
+	b.flushLocked()
+}
+
+// flush sends the requests that reached the collector so far
+func (b *batchCollector) flush() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.flushLocked()
+}
+
+// flushLocked sends the pending requests once, the lock must be held
+func (b *batchCollector) flushLocked() {
+	if b.sent {
+		return
+	}
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	b.sent = true
+	batch := b.pending
+	go func() {
+		if len(batch) > 0 {
+			b.err = sendPending(b.ctx, b.next, batch)
+		}
+		close(b.done)
+	}()
+}
@@ -0,0 +1,314 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type batchQuery struct {
+	Message string `json:"message" gql_params:"name:String"`
+}
+
+// batchServer answers every operation of a batch with the name variable, names starting with "err" get an error
+func batchServer(t *testing.T, batches *[]int) *httptest.Server {
+	lock := sync.Mutex{}
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		bodies := []graphqlRequest{}
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&bodies))
+		lock.Lock()
+		*batches = append(*batches, len(bodies))
+		lock.Unlock()
+		results := []string{}
+		for _, body := range bodies {
+			name := body.Variables["name"].(string)
+			if len(name) >= 3 && name[:3] == "err" {
+				results = append(results, fmt.Sprintf(`{"errors":[{"message":%q}]}`, name))
+				continue
+			}
+			results = append(results, fmt.Sprintf(`{"data":{"message":%q}}`, name))
+		}
+		rw.Write([]byte("["))
+		for i, result := range results {
+			if i > 0 {
+				rw.Write([]byte(","))
+			}
+			rw.Write([]byte(result))
+		}
+		rw.Write([]byte("]"))
+	}))
+}
+
+func TestClientBatch(t *testing.T) {
+	assert := assert.New(t)
+	batches := []int{}
+	server := batchServer(t, &batches)
+	defer server.Close()
+	c := NewClient(NewSimpleHTTPTransport(server.URL))
+	one, two, three := &batchQuery{}, &batchQuery{}, &batchQuery{}
+	results, err := c.Batch(
+		c.NewRequest().Query(one).WithVariable("name", "one"),
+		c.NewRequest().Query(two).WithVariable("name", "err two"),
+		c.NewRequest().Query(three).WithVariable("name", "three"),
+	)
+	assert.NoError(err)
+	assert.Equal([]int{3}, batches)
+	assert.Len(results, 3)
+	assert.NoError(results[0].Err)
+	assert.Equal("one", one.Message)
+	assert.Equal(one, results[0].Response.Response)
+	assert.EqualError(results[1].Err, "graphql: err two")
+	assert.Len(results[1].Response.Errors, 1)
+	assert.NoError(results[2].Err)
+	assert.Equal("three", three.Message)
+}
+
+func TestBatchFailsAsAWhole(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`{"errors":[{"message":"batching is not supported"}]}`))
+	}))
+	defer server.Close()
+	c := NewClient(NewSimpleHTTPTransport(server.URL))
+	_, err := c.Batch(c.NewRequest().Query(&batchQuery{}).WithVariable("name", "one"))
+	assert.EqualError(err, "graphql: batching is not supported")
+
+	server.Config.Handler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`[]`))
+	})
+	_, err = c.Batch(c.NewRequest().Query(&batchQuery{}).WithVariable("name", "one"))
+	assert.EqualError(err, "graphql: sent 1 operations in a batch but got 0 results")
+}
+
+func TestBatchWithoutBatchTransport(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	transport := TransportFunc(func(ctx context.Context, req Request) (Response, error) {
+		calls++
+		if calls == 2 {
+			return Response{}, errors.New("boom")
+		}
+		return Response{Response: req.GetInterface()}, nil
+	})
+	c := NewClient(transport)
+	results, err := c.Batch(c.NewRequest().Query(&batchQuery{}), c.NewRequest().Query(&batchQuery{}))
+	assert.NoError(err)
+	assert.Equal(2, calls)
+	assert.NoError(results[0].Err)
+	assert.EqualError(results[1].Err, "boom")
+}
+
+func TestBatchingTransportCoalescesRequests(t *testing.T) {
+	assert := assert.New(t)
+	batches := []int{}
+	server := batchServer(t, &batches)
+	defer server.Close()
+	c := NewClient(NewBatchingTransport(NewSimpleHTTPTransport(server.URL), 50*time.Millisecond, 0))
+
+	wg := sync.WaitGroup{}
+	queries := make([]*batchQuery, 5)
+	errs := make([]error, 5)
+	for i := range queries {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			queries[i] = &batchQuery{}
+			_, errs[i] = c.NewRequest().Query(queries[i]).WithVariable("name", fmt.Sprint("name", i)).Send()
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal([]int{5}, batches)
+	for i, query := range queries {
+		assert.NoError(errs[i])
+		assert.Equal(fmt.Sprint("name", i), query.Message)
+	}
+}
+
+func TestBatchingTransportMaxSize(t *testing.T) {
+	assert := assert.New(t)
+	batches := []int{}
+	server := batchServer(t, &batches)
+	defer server.Close()
+	c := NewClient(NewBatchingTransport(NewSimpleHTTPTransport(server.URL), time.Hour, 2))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := c.NewRequest().Query(&batchQuery{}).WithVariable("name", fmt.Sprint("name", i)).Send()
+			assert.NoError(err)
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal([]int{2, 2}, batches)
+}
+
+func TestBatchingTransportContext(t *testing.T) {
+	assert := assert.New(t)
+	batches := []int{}
+	server := batchServer(t, &batches)
+	defer server.Close()
+	transport := NewBatchingTransport(NewSimpleHTTPTransport(server.URL), time.Hour, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := transport.TransportContext(ctx, newReq().Query(&batchQuery{}).WithVariable("name", "one"))
+	assert.Equal(context.DeadlineExceeded, err)
+}
+
+// recordHeader makes the server record the value of the header on every request it gets
+func recordHeader(server *httptest.Server, name string, seen *[]string) {
+	lock := sync.Mutex{}
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		*seen = append(*seen, req.Header.Get(name))
+		lock.Unlock()
+		handler.ServeHTTP(rw, req)
+	})
+}
+
+func TestBatchGoesThroughMiddlewares(t *testing.T) {
+	assert := assert.New(t)
+	batches := []int{}
+	server := batchServer(t, &batches)
+	defer server.Close()
+	seen := []string{}
+	recordHeader(server, "Authorization", &seen)
+	var timed int32
+	c := NewClient(NewSimpleHTTPTransport(server.URL)).
+		Use(Headers(http.Header{"Authorization": {"Bearer token"}})).
+		Use(Timing(func(req Request, duration time.Duration, err error) {
+			atomic.AddInt32(&timed, 1)
+		}))
+	one, two := &batchQuery{}, &batchQuery{}
+	results, err := c.Batch(
+		c.NewRequest().Query(one).WithVariable("name", "one"),
+		c.NewRequest().Query(two).WithVariable("name", "err two"),
+	)
+	assert.NoError(err)
+	assert.Equal([]int{2}, batches)
+	assert.Equal([]string{"Bearer token"}, seen)
+	assert.Equal(int32(2), atomic.LoadInt32(&timed))
+	assert.NoError(results[0].Err)
+	assert.Equal("one", one.Message)
+	assert.EqualError(results[1].Err, "graphql: err two")
+}
+
+func TestBatchSkipsRequestsAnsweredByMiddlewares(t *testing.T) {
+	assert := assert.New(t)
+	batches := []int{}
+	server := batchServer(t, &batches)
+	defer server.Close()
+	c := NewClient(NewSimpleHTTPTransport(server.URL)).Use(func(next Transport) Transport {
+		return TransportFunc(func(ctx context.Context, req Request) (Response, error) {
+			if req.GetVariables()["name"] == "cached" {
+				return Response{Response: "from cache"}, nil
+			}
+			return TransportWithContext(ctx, next, req)
+		})
+	})
+	results, err := c.Batch(
+		c.NewRequest().Query(&batchQuery{}).WithVariable("name", "one"),
+		c.NewRequest().Query(&batchQuery{}).WithVariable("name", "cached"),
+		c.NewRequest().Query(&batchQuery{}).WithVariable("name", "three"),
+	)
+	assert.NoError(err)
+	assert.Equal([]int{2}, batches)
+	assert.Equal("from cache", results[1].Response.Response)
+	assert.Equal("three", results[2].Response.Response.(*batchQuery).Message)
+}
+
+func TestBatchWithMiddlewaresFailsAsAWhole(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`{"errors":[{"message":"batching is not supported"}]}`))
+	}))
+	defer server.Close()
+	c := NewClient(NewSimpleHTTPTransport(server.URL)).Use(Headers(http.Header{"Authorization": {"Bearer token"}}))
+	_, err := c.Batch(c.NewRequest().Query(&batchQuery{}).WithVariable("name", "one"))
+	assert.EqualError(err, "graphql: batching is not supported")
+}
+
+func TestBatchingTransportSendsContextHeaders(t *testing.T) {
+	assert := assert.New(t)
+	batches := []int{}
+	server := batchServer(t, &batches)
+	defer server.Close()
+	seen := []string{}
+	recordHeader(server, "Authorization", &seen)
+	c := NewClient(NewBatchingTransport(NewSimpleHTTPTransport(server.URL), 50*time.Millisecond, 0))
+
+	wg := sync.WaitGroup{}
+	for i, token := range []string{"a", "b", "a"} {
+		wg.Add(1)
+		go func(i int, token string) {
+			defer wg.Done()
+			ctx := ContextWithHeaders(context.Background(), http.Header{"Authorization": {token}})
+			_, err := c.NewRequest().Query(&batchQuery{}).WithVariable("name", fmt.Sprint("name", i)).SendContext(ctx)
+			assert.NoError(err)
+		}(i, token)
+	}
+	wg.Wait()
+	assert.ElementsMatch([]int{1, 2}, batches)
+	assert.ElementsMatch([]string{"a", "b"}, seen)
+}
+
+func TestBatchWithConcurrencyLimitingMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	// the requests can only go through the middleware one at a time: the first is sent as a batch of its own once
+	// the window is over, the second is sent alone after the batch was sent
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		raw := json.RawMessage{}
+		assert.NoError(json.NewDecoder(req.Body).Decode(&raw))
+		if raw[0] == '[' {
+			bodies := []graphqlRequest{}
+			assert.NoError(json.Unmarshal(raw, &bodies))
+			requests = append(requests, fmt.Sprint("batch of ", len(bodies)))
+			fmt.Fprintf(rw, `[{"data":{"message":%q}}]`, bodies[0].Variables["name"])
+			return
+		}
+		body := graphqlRequest{}
+		assert.NoError(json.Unmarshal(raw, &body))
+		requests = append(requests, "single")
+		fmt.Fprintf(rw, `{"data":{"message":%q}}`, body.Variables["name"])
+	}))
+	defer server.Close()
+	sem := make(chan struct{}, 1)
+	c := NewClient(NewSimpleHTTPTransport(server.URL)).Use(func(next Transport) Transport {
+		return TransportFunc(func(ctx context.Context, req Request) (Response, error) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			return TransportWithContext(ctx, next, req)
+		})
+	})
+	done := make(chan struct{})
+	var results []BatchResult
+	var err error
+	go func() {
+		defer close(done)
+		results, err = c.Batch(
+			c.NewRequest().Query(&batchQuery{}).WithVariable("name", "one"),
+			c.NewRequest().Query(&batchQuery{}).WithVariable("name", "two"),
+		)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the batch never returned")
+	}
+	assert.NoError(err)
+	assert.Equal([]string{"batch of 1", "single"}, requests)
+	assert.NoError(results[0].Err)
+	assert.NoError(results[1].Err)
+}
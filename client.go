@@ -1,6 +1,10 @@
 package graphql
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+	"sync"
+)
 
 // Request represents a graphql request to some API
 type Request interface {
@@ -8,6 +12,9 @@ type Request interface {
 	// SetTransport sets the transport for the request when send
 	SetTransport(transport Transport) Request
 
+	// Named sets the operation name of the request, it is written into the query and sent as operationName
+	Named(name string) Request
+
 	//WithVariable adds a variable to the request
 	WithVariable(name string, value interface{}) Request
 
@@ -21,13 +28,37 @@ type Request interface {
 	// Respects the json tags) or you could use the graphql tags for more specific uses
 	Mutation(object interface{}) Request
 
+	// Subscription sets the request to a subscription. The object is used the same way as in Query and
+	// Mutation, every result the subscription receives is decoded into a new copy of it
+	Subscription(object interface{}) Request
+
 	// Send sends the request to the graphql API. This returns a filled out version of the interface passed
 	// into query or mutation methods
 	Send() (Response, error)
 
+	// SendContext sends the request to the graphql API using the given context. If the transport implements
+	// ContextTransport the context is handed down to it so the request can be cancelled or carry a deadline.
+	SendContext(ctx context.Context) (Response, error)
+
+	// Subscribe starts a subscription on a transport that implements SubscriptionTransport and calls the
+	// handler for every result. This blocks until the subscription completes or the context is done.
+	Subscribe(ctx context.Context, handler SubscriptionHandler) error
+
+	// Err returns the error building the request failed with, like an object that can't be marshaled or a
+	// variable whose type can't be inferred. Send, SendContext, Subscribe and Batch return it without sending
+	// the request.
+	Err() error
+
 	// GetQuery gets the full query
 	GetQuery() string
 
+	// GetOperationType gets the type of the operation: query, mutation or subscription
+	GetOperationType() string
+
+	// GetOperationName gets the name of the operation. This is the name passed to Named, or the name returned by
+	// the object when it implements GqlOperationNamer
+	GetOperationName() string
+
 	//GetVariables gets the variables for the request
 	GetVariables() map[string]interface{}
 
@@ -35,6 +66,11 @@ type Request interface {
 	GetInterface() interface{}
 }
 
+// GqlOperationNamer can be implemented by query and mutation structs to name the operations they are used in
+type GqlOperationNamer interface {
+	GqlOperationName() string
+}
+
 // Response represents a response from a graphql api
 type Response struct {
 	// HttpResponse gets the header off the response
@@ -43,6 +79,9 @@ type Response struct {
 	Payload []byte
 	// obj is the object to unserialize
 	Response interface{}
+	// Errors are the graphql errors the api sent back. The api can send back errors and data at the same time,
+	// so Response can be filled out even if there are errors. Errors.Paths tells which fields were nulled.
+	Errors Errors
 	// HttpRequest is the raw Request
 	HttpRequest *http.Request
 }
@@ -53,17 +92,39 @@ type Transport interface {
 	Transport(req Request) (Response, error)
 }
 
+// ContextTransport is a Transport that can also take a context. Requests sent with SendContext will use
+// TransportContext when the transport implements it.
+type ContextTransport interface {
+	Transport
+	// TransportContext transports the request to an API using ctx for cancellation, deadlines and
+	// request scoped values.
+	TransportContext(ctx context.Context, req Request) (Response, error)
+}
+
 // Client represents a GraphQL client
 type Client interface {
 	// NewRequest makes a new request to send to some graphql response
 	NewRequest() Request
 
-	// AddRequestModifier adds a request modifier to the client, use this to add headers or do some retry logic
+	// SetTransport sets the transport requests made by the client are sent with
 	SetTransport(transport Transport) Client
+
+	// Use adds middlewares that wrap the transport of the client, use this to add headers or do some retry
+	// logic. Middlewares wrap each other in the order they are added: the first one sees the request first and
+	// the response last.
+	Use(middlewares ...Middleware) Client
+
+	// Batch sends the requests in a single round trip when the transport of the client implements
+	// BatchTransport, otherwise they are sent one after the other. The results are in the same order as reqs.
+	Batch(reqs ...Request) ([]BatchResult, error)
+
+	// BatchContext is Batch with a context
+	BatchContext(ctx context.Context, reqs ...Request) ([]BatchResult, error)
 }
 
 type client struct {
-	transport Transport
+	transport   Transport
+	middlewares []Middleware
 }
 
 // NewClient returns a new Graphql Client
@@ -75,10 +136,104 @@ func NewClient(transport Transport) Client {
 
 func (c *client) NewRequest() Request {
 	req := newReq()
-	req.SetTransport(c.transport)
+	req.SetTransport(c.chain())
 	return req
 }
 
+func (c *client) Use(middlewares ...Middleware) Client {
+	c.middlewares = append(c.middlewares, middlewares...)
+	return c
+}
+
+func (c *client) Batch(reqs ...Request) ([]BatchResult, error) {
+	return c.BatchContext(context.Background(), reqs...)
+}
+
+func (c *client) BatchContext(ctx context.Context, reqs ...Request) ([]BatchResult, error) {
+	results := make([]BatchResult, len(reqs))
+	valid := []Request{}
+	positions := []int{}
+	for i, req := range reqs {
+		if err := req.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+		valid = append(valid, req)
+		positions = append(positions, i)
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+	sent, err := c.sendBatch(ctx, valid)
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range sent {
+		results[positions[i]] = result
+	}
+	return results, nil
+}
+
+// sendBatch sends the requests through the middlewares of the client. When the transport of the client is a
+// BatchTransport, the requests that make it through the middlewares are sent to it in a single batch.
+func (c *client) sendBatch(ctx context.Context, reqs []Request) ([]BatchResult, error) {
+	next, ok := c.transport.(BatchTransport)
+	if len(c.middlewares) == 0 || !ok {
+		return sendBatch(ctx, c.transport, reqs)
+	}
+	collector := newBatchCollector(ctx, c.transport, next, len(reqs))
+	transport := c.wrap(collector)
+	results := make([]BatchResult, len(reqs))
+	wg := sync.WaitGroup{}
+	for i, req := range reqs {
+		wg.Add(1)
+		go func(i int, req Request) {
+			defer wg.Done()
+			results[i].Response, results[i].Err = collector.send(transport, req)
+		}(i, req)
+	}
+	wg.Wait()
+	<-collector.done
+	if collector.err == nil {
+		return results, nil
+	}
+	// the batch failed as a whole, unless a middleware like Retry got a result for some of its requests
+	for _, result := range results {
+		if result.Err == nil {
+			return results, nil
+		}
+	}
+	return nil, collector.err
+}
+
+// chain wraps the transport of the client in its middlewares
+func (c *client) chain() Transport {
+	if len(c.middlewares) == 0 {
+		return c.transport
+	}
+	subscriptions := c.transport
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		// subscriptions skip the middlewares that only wrap sending requests
+		if wrapped := c.middlewares[i](subscriptions); isSubscriptionTransport(wrapped) {
+			subscriptions = wrapped
+		}
+	}
+	return &chainedTransport{next: c.wrap(c.transport), subscriptions: subscriptions}
+}
+
+// wrap returns transport wrapped in the middlewares of the client
+func (c *client) wrap(transport Transport) Transport {
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		transport = c.middlewares[i](transport)
+	}
+	return transport
+}
+
+func isSubscriptionTransport(t Transport) bool {
+	_, ok := t.(SubscriptionTransport)
+	return ok
+}
+
 func (c *client) SetTransport(t Transport) Client {
 	c.transport = t
 	return c
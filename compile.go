@@ -0,0 +1,184 @@
+package graphql
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// maxRenderedQueries is how many rendered documents a compiled query keeps, one for every set of variables
+const maxRenderedQueries = 64
+
+// compiledQuery is the selection set of an object marshaled for a request. The selection set of a go type is built
+// once and shared by every request for the type, so it is never changed after it is built: the args are rendered
+// for the variables of each request instead of being marked on the parts.
+type compiledQuery struct {
+	root      *QueryPart
+	fragments []*QueryPart
+	// variables are the values of variables the object brings with it, like the ones of Aliased
+	variables map[string]interface{}
+	err       error
+	// hasUntyped is set when an arg is declared without a type and its type is inferred from its variable
+	hasUntyped bool
+	// rendered are the documents rendered for the sets of variables, when the query is shared between requests
+	rendered      sync.Map
+	renderedCount int32
+	shared        bool
+}
+
+var (
+	// compiledQueries maps go types to their shared compiledQuery
+	compiledQueries = sync.Map{}
+	// cacheableTypes caches whether the selection set of a type only depends on the type
+	cacheableTypes = sync.Map{}
+)
+
+func newCompiledQuery(m *Marshaler, err error) *compiledQuery {
+	query := &compiledQuery{root: m.rootPart, fragments: m.fragments, variables: m.variables, err: err}
+	types := map[string]string{}
+	for _, part := range query.parts() {
+		if part != nil && part.hasUntypedArgs() {
+			query.hasUntyped = true
+		}
+		if part != nil && query.err == nil {
+			query.err = part.checkVariableTypes(types)
+		}
+	}
+	return query
+}
+
+// compile marshals obj, reusing the selection set built for its type before when it only depends on the type.
+// Objects holding a GqlMarshaler are marshaled every time because their selection can depend on their value.
+func compile(obj interface{}) *compiledQuery {
+	tp := reflect.TypeOf(obj)
+	if tp == nil || tp.Kind() != reflect.Ptr || !isCacheable(tp) {
+		m := NewMarshaler()
+		_, err := m.MarshalToGraphql(obj)
+		return newCompiledQuery(m, err)
+	}
+	if query, ok := compiledQueries.Load(tp); ok {
+		return query.(*compiledQuery)
+	}
+	m := NewMarshaler()
+	_, err := m.MarshalToGraphql(reflect.New(tp.Elem()).Interface())
+	query := newCompiledQuery(m, err)
+	query.shared = true
+	actual, _ := compiledQueries.LoadOrStore(tp, query)
+	return actual.(*compiledQuery)
+}
+
+// clearCompiledQueries drops the shared selection sets, they are built again the next time they are used
+func clearCompiledQueries() {
+	compiledQueries.Range(func(key, value interface{}) bool {
+		compiledQueries.Delete(key)
+		return true
+	})
+}
+
+// isCacheable reports whether the selection set of tp only depends on the type
+func isCacheable(tp reflect.Type) bool {
+	if cacheable, ok := cacheableTypes.Load(tp); ok {
+		return cacheable.(bool)
+	}
+	cacheable := searchCacheable(tp, map[reflect.Type]bool{})
+	cacheableTypes.Store(tp, cacheable)
+	return cacheable
+}
+
+func searchCacheable(tp reflect.Type, visited map[reflect.Type]bool) bool {
+	if tp.Implements(marshalerType) || (tp.Kind() != reflect.Ptr && reflect.PtrTo(tp).Implements(marshalerType)) {
+		return false
+	}
+	switch tp.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return searchCacheable(tp.Elem(), visited)
+	case reflect.Struct:
+		if visited[tp] {
+			return true
+		}
+		visited[tp] = true
+		for i := 0; i < tp.NumField(); i++ {
+			if !searchCacheable(tp.Field(i).Type, visited) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parts returns the selection set followed by the fragment definitions
+func (c *compiledQuery) parts() []*QueryPart {
+	return append([]*QueryPart{c.root}, c.fragments...)
+}
+
+// collectArgs returns the variable definitions of the args sent for the variables in needed. A variable used in
+// several places is declared once. Args declared without a type take theirs from inferred.
+func (c *compiledQuery) collectArgs(inferred map[string]string, needed *set) []string {
+	args := []string{}
+	for _, part := range c.parts() {
+		args = append(args, part.collectTypedArgs(inferred, needed)...)
+	}
+	return uniqueVariables(args)
+}
+
+// untypedArgs returns the variables in needed that are used by args declared without a type
+func (c *compiledQuery) untypedArgs(needed *set) []string {
+	if !c.hasUntyped {
+		return nil
+	}
+	untyped := []string{}
+	for _, part := range c.parts() {
+		untyped = append(untyped, part.untypedArgs(needed)...)
+	}
+	return untyped
+}
+
+// render writes the document for an operation with the given variables. Shared queries keep the documents they
+// rendered, keyed by everything the document depends on.
+func (c *compiledQuery) render(tp string, name string, variables map[string]interface{}) string {
+	needed := newSet()
+	names := make([]string, 0, len(variables))
+	for variable := range variables {
+		needed.add(variable)
+		names = append(names, variable)
+	}
+	var inferred map[string]string
+	if c.hasUntyped {
+		inferred = inferTypes(variables)
+	}
+	key := ""
+	if c.shared {
+		sort.Strings(names)
+		keyBuilder := &strings.Builder{}
+		keyBuilder.WriteString(tp + " " + name)
+		for _, variable := range names {
+			keyBuilder.WriteString("\x00" + variable + ":" + inferred[variable])
+		}
+		key = keyBuilder.String()
+		if rendered, ok := c.rendered.Load(key); ok {
+			return rendered.(string)
+		}
+	}
+	collectedArgs := c.collectArgs(inferred, needed)
+	builder := &strings.Builder{}
+	builder.WriteString(tp)
+	if name != "" {
+		builder.WriteString(" ")
+		builder.WriteString(name)
+	}
+	if len(collectedArgs) > 0 {
+		builder.WriteString("(")
+		builder.WriteString(strings.Join(collectedArgs, ", "))
+		builder.WriteString(")")
+	}
+	for _, part := range c.parts() {
+		part.render(builder, 0, needed)
+	}
+	rendered := builder.String()
+	if c.shared && atomic.AddInt32(&c.renderedCount, 1) <= maxRenderedQueries {
+		c.rendered.Store(key, rendered)
+	}
+	return rendered
+}
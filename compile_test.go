@@ -0,0 +1,156 @@
+package graphql
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type cachedQuery struct {
+	Hero struct {
+		Name    string `json:"name"`
+		Friends []struct {
+			Name string `json:"name"`
+		} `json:"friends" gql_params:"first:Int" gql_directives:"include(if:$withFriends)"`
+	} `json:"hero" gql_params:"id:ID!"`
+}
+
+func TestCompiledQueriesAreSharedPerType(t *testing.T) {
+	assert := assert.New(t)
+	one := compile(&cachedQuery{})
+	two := compile(&cachedQuery{})
+	assert.True(one == two)
+	assert.True(one.shared)
+	assert.False(compile(&struct{ cachedQuery }{}) == one)
+}
+
+func TestSharedQueriesRenderPerVariables(t *testing.T) {
+	assert := assert.New(t)
+	withID := newReq().Query(&cachedQuery{}).WithVariable("id", "1")
+	withAll := newReq().Query(&cachedQuery{}).
+		WithVariable("id", "1").
+		WithVariable("first", 2).
+		WithVariable("withFriends", true)
+	none := newReq().Query(&cachedQuery{})
+	for i := 0; i < 2; i++ {
+		assert.Equal(`query($id:ID!){
+    hero(id:$id){
+        name
+        friends{
+            name
+        }
+    }
+}
+`, withID.GetQuery())
+		assert.Equal(`query($id:ID!, $first:Int, $withFriends:Boolean!){
+    hero(id:$id){
+        name
+        friends(first:$first) @include(if:$withFriends){
+            name
+        }
+    }
+}
+`, withAll.GetQuery())
+		assert.Equal("query{\n    hero{\n        name\n        friends{\n            name\n        }\n    }\n}\n", none.GetQuery())
+	}
+	assert.True(strings.HasPrefix(withID.Named("Named").GetQuery(), "query Named($id:ID!){"))
+}
+
+func TestSharedQueriesKeyInferredTypes(t *testing.T) {
+	assert := assert.New(t)
+	type inferredQuery struct {
+		User struct {
+			Name string `json:"name"`
+		} `json:"user" gql_params:"id"`
+	}
+	assert.Contains(newReq().Query(&inferredQuery{}).WithVariable("id", 1).GetQuery(), "query($id:Int!)")
+	assert.Contains(newReq().Query(&inferredQuery{}).WithVariable("id", ID("1")).GetQuery(), "query($id:ID!)")
+}
+
+func TestValueDependentQueriesAreNotShared(t *testing.T) {
+	assert := assert.New(t)
+	users := []aliasedUser{}
+	assert.False(isCacheable(reflect.TypeOf(Each("user", &users, nil))))
+	assert.False(isCacheable(reflect.TypeOf(&struct {
+		Mock []someMock `json:"mock"`
+	}{})))
+	assert.True(isCacheable(reflect.TypeOf(&treeNode{})))
+	one := newReq().Query(Each("user", &users, []Args{{"id": "1"}}))
+	two := newReq().Query(Each("user", &users, []Args{{"id": "1"}, {"id": "2"}}))
+	assert.NotContains(one.GetQuery(), "user1")
+	assert.Contains(two.GetQuery(), "user1")
+}
+
+func TestSharedQueriesAreSafeForConcurrentUse(t *testing.T) {
+	assert := assert.New(t)
+	wg := sync.WaitGroup{}
+	queries := make([]string, 50)
+	for i := range queries {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := newReq().Query(&cachedQuery{}).WithVariable("id", fmt.Sprint(i))
+			if i%2 == 0 {
+				req.WithVariable("first", i)
+			}
+			queries[i] = req.GetQuery()
+		}(i)
+	}
+	wg.Wait()
+	for i, query := range queries {
+		if i%2 == 0 {
+			assert.Equal(queries[0], query)
+		} else {
+			assert.Equal(queries[1], query)
+		}
+	}
+	assert.NotEqual(queries[0], queries[1])
+}
+
+type benchmarkQuery struct {
+	Hero struct {
+		Name      string  `json:"name"`
+		Height    float64 `json:"height"`
+		Character struct {
+			Droid *droidFields `gql:"... on Droid"`
+			Human *humanFields `gql:"... on Human"`
+		} `json:"character"`
+		Friends []struct {
+			ID      string `json:"id"`
+			Name    string `json:"name"`
+			Friends []struct {
+				Name string `json:"name"`
+			} `json:"friends" gql_params:"first:Int"`
+		} `json:"friends" gql_params:"first:Int,after:String"`
+	} `json:"hero" gql_params:"id:ID!"`
+}
+
+func BenchmarkGetQueryShared(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		newReq().Query(&benchmarkQuery{}).WithVariable("id", "1").WithVariable("first", 10).GetQuery()
+	}
+}
+
+func BenchmarkGetQueryUncached(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m := NewMarshaler()
+		m.MarshalToGraphql(&benchmarkQuery{})
+		query := newCompiledQuery(m, nil)
+		query.render("query", "", map[string]interface{}{"id": "1", "first": 10})
+	}
+}
+
+func BenchmarkGetQuerySharedParallel(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			newReq().Query(&benchmarkQuery{}).WithVariable("id", "1").WithVariable("first", 10).GetQuery()
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package graphql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// directiveVariable matches a variable used in the arguments of a directive with its optional type, e.g. $ttl:Int
+var directiveVariable = regexp.MustCompile(`\$(\w+)(?:\s*:\s*([\w\[\]!]+))?`)
+
+// directive is a directive attached to a field, e.g. @include(if: $withFriends)
+type directive struct {
+	name string
+	// args are the arguments as they are sent, with the variable types taken out
+	args string
+	// variables are the variables the arguments use, in the order they appear
+	variables []string
+	// types maps the variables to their graphql type
+	types map[string]string
+}
+
+// parseDirectives reads a gql_directives tag. Directives are separated by ";" and their arguments are written the
+// way they are sent. Variables are declared with the operation like gql_params are: the variable in the if
+// argument of include and skip is a Boolean!, any other variable needs its type written after it as $name:Type.
+func parseDirectives(tag string) ([]*directive, error) {
+	directives := []*directive{}
+	for _, raw := range strings.Split(tag, ";") {
+		raw = strings.TrimPrefix(strings.TrimSpace(raw), "@")
+		if raw == "" {
+			continue
+		}
+		d := &directive{name: raw, types: map[string]string{}}
+		if open := strings.Index(raw, "("); open >= 0 {
+			if !strings.HasSuffix(raw, ")") {
+				return nil, fmt.Errorf("directive %q is missing a closing parenthesis", raw)
+			}
+			d.name = strings.TrimSpace(raw[:open])
+			args, err := d.parseArgs(raw[open+1 : len(raw)-1])
+			if err != nil {
+				return nil, err
+			}
+			d.args = args
+		}
+		directives = append(directives, d)
+	}
+	return directives, nil
+}
+
+func (d *directive) parseArgs(args string) (string, error) {
+	var err error
+	rendered := directiveVariable.ReplaceAllStringFunc(args, func(match string) string {
+		groups := directiveVariable.FindStringSubmatch(match)
+		name, tp := groups[1], groups[2]
+		if tp == "" && (d.name == "include" || d.name == "skip") {
+			tp = "Boolean!"
+		}
+		if tp == "" && err == nil {
+			err = fmt.Errorf("variable $%s of directive @%s needs a type, e.g. $%s:String", name, d.name, name)
+		}
+		if _, ok := d.types[name]; !ok {
+			d.variables = append(d.variables, name)
+		}
+		d.types[name] = tp
+		return "$" + name
+	})
+	return strings.TrimSpace(rendered), err
+}
+
+// String renders the directive, e.g. @include(if:$withFriends)
+func (d *directive) String() string {
+	if d.args == "" {
+		return "@" + d.name
+	}
+	return fmt.Sprintf("@%s(%s)", d.name, d.args)
+}
@@ -0,0 +1,107 @@
+package graphql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDirectives(t *testing.T) {
+	assert := assert.New(t)
+	directives, err := parseDirectives("include(if: $withFriends); @cached(ttl: 60) ;deprecated; rateLimited(max:$max:Int!, per:$per: [String!])")
+	assert.NoError(err)
+	assert.Len(directives, 4)
+	assert.Equal("@include(if: $withFriends)", directives[0].String())
+	assert.Equal([]string{"withFriends"}, directives[0].variables)
+	assert.Equal("Boolean!", directives[0].types["withFriends"])
+	assert.Equal("@cached(ttl: 60)", directives[1].String())
+	assert.Empty(directives[1].variables)
+	assert.Equal("@deprecated", directives[2].String())
+	assert.Equal("@rateLimited(max:$max, per:$per)", directives[3].String())
+	assert.Equal([]string{"max", "per"}, directives[3].variables)
+	assert.Equal("[String!]", directives[3].types["per"])
+}
+
+func TestParseDirectivesErrors(t *testing.T) {
+	assert := assert.New(t)
+	_, err := parseDirectives("cached(ttl: $ttl)")
+	assert.EqualError(err, "variable $ttl of directive @cached needs a type, e.g. $ttl:String")
+	_, err = parseDirectives("include(if: $x")
+	assert.Error(err)
+}
+
+type directiveQuery struct {
+	Hero struct {
+		Name    string `json:"name" gql_directives:"cached(ttl: 60)"`
+		Friends []struct {
+			Name string `json:"name"`
+		} `json:"friends" gql_params:"first:Int" gql_directives:"include(if:$withFriends)"`
+		Starships []struct {
+			Name string `json:"name"`
+		} `json:"starships" gql_directives:"skip(if:$withFriends)"`
+	} `json:"hero" gql_params:"id:ID!"`
+}
+
+func TestRendersDirectives(t *testing.T) {
+	assert := assert.New(t)
+	query := newReq().Query(&directiveQuery{}).
+		WithVariable("id", "1").
+		WithVariable("first", 2).
+		WithVariable("withFriends", true).
+		GetQuery()
+	assert.True(strings.HasPrefix(query, "query($id:ID!, $first:Int, $withFriends:Boolean!){"), query)
+	assert.Equal(1, strings.Count(query, "$withFriends:Boolean!"))
+	assert.Contains(query, "name @cached(ttl: 60)\n")
+	assert.Contains(query, "friends(first:$first) @include(if:$withFriends){")
+	assert.Contains(query, "starships @skip(if:$withFriends){")
+}
+
+func TestOmitsDirectivesWithoutVariables(t *testing.T) {
+	assert := assert.New(t)
+	query := newReq().Query(&directiveQuery{}).WithVariable("id", "1").GetQuery()
+	assert.True(strings.HasPrefix(query, "query($id:ID!){"), query)
+	assert.Contains(query, "name @cached(ttl: 60)\n")
+	assert.Contains(query, "friends{")
+	assert.NotContains(query, "withFriends")
+}
+
+func TestDirectivesOnInlineFragments(t *testing.T) {
+	assert := assert.New(t)
+	query := newReq().Query(&struct {
+		Hero struct {
+			Droid *droidFields `gql:"... on Droid" gql_directives:"include(if:$droids)"`
+		} `json:"hero"`
+	}{}).WithVariable("droids", false).GetQuery()
+	assert.True(strings.HasPrefix(query, "query($droids:Boolean!){"), query)
+	assert.Contains(query, "... on Droid @include(if:$droids){")
+}
+
+func TestMarshalReturnsDirectiveErrors(t *testing.T) {
+	assert := assert.New(t)
+	_, err := Marshal(&struct {
+		Name string `json:"name" gql_directives:"cached(ttl:$ttl)"`
+	}{})
+	assert.EqualError(err, "Name: variable $ttl of directive @cached needs a type, e.g. $ttl:String")
+}
+
+func TestDeclaresVariableSharedWithDirectiveOnce(t *testing.T) {
+	assert := assert.New(t)
+	req := newReq().Query(&struct {
+		Hero struct {
+			Name string `json:"name" gql_directives:"include(if:$flag)"`
+		} `json:"hero" gql_params:"flag:Boolean!"`
+	}{}).WithVariable("flag", true)
+	assert.NoError(req.Err())
+	assert.True(strings.HasPrefix(req.GetQuery(), "query($flag:Boolean!){"))
+}
+
+func TestVariableDeclaredWithTwoTypesIsAnError(t *testing.T) {
+	assert := assert.New(t)
+	req := newReq().Query(&struct {
+		Hero struct {
+			Name string `json:"name" gql_directives:"include(if:$flag)"`
+		} `json:"hero" gql_params:"flag:String"`
+	}{}).WithVariable("flag", "on")
+	assert.EqualError(req.Err(), "variable $flag is declared as both String and Boolean!")
+}
@@ -0,0 +1,149 @@
+package graphql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Location is the line and column in the query an error points to
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error is a single error returned by a graphql api
+type Error struct {
+	// Message is the description of the error
+	Message string `json:"message"`
+	// Locations are the places in the query the error is associated with
+	Locations []Location `json:"locations,omitempty"`
+	// Path is the path of the response field that caused the error. Entries are field names or list indices
+	Path []interface{} `json:"path,omitempty"`
+	// Extensions is any additional information the server added to the error
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e Error) Error() string {
+	return "graphql: " + e.Message
+}
+
+// Code returns the code found in the extensions of the error, or an empty string if there is none
+func (e Error) Code() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+// PathString returns the path of the error in the form "hero.friends[0].name" or an empty string if the error has
+// no path
+func (e Error) PathString() string {
+	builder := &strings.Builder{}
+	for _, elem := range e.Path {
+		if name, ok := elem.(string); ok {
+			if builder.Len() > 0 {
+				builder.WriteString(".")
+			}
+			builder.WriteString(name)
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("[%v]", elem))
+	}
+	return builder.String()
+}
+
+// hasPrefix reports whether the path of the error starts with prefix. List indices can be given as any number type.
+func (e Error) hasPrefix(prefix []interface{}) bool {
+	if len(e.Path) < len(prefix) {
+		return false
+	}
+	for i, elem := range prefix {
+		if fmt.Sprint(e.Path[i]) != fmt.Sprint(elem) {
+			return false
+		}
+	}
+	return true
+}
+
+// Is reports whether target is an Error with the same code. If target has no code, the messages are compared.
+// This lets errors.Is(err, graphql.Error{Extensions: map[string]interface{}{"code": "UNAUTHENTICATED"}}) be used
+// to check for a server error code.
+func (e Error) Is(target error) bool {
+	t, ok := target.(Error)
+	if !ok {
+		return false
+	}
+	if code := t.Code(); code != "" {
+		return e.Code() == code
+	}
+	return t.Message != "" && e.Message == t.Message
+}
+
+// Errors is the list of errors returned by a graphql api for a single request
+type Errors []Error
+
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Message)
+	}
+	return "graphql: " + strings.Join(messages, "; ")
+}
+
+// Is reports whether any of the errors matches target
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if err.Is(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As sets target to the first error when target is a *Error
+func (e Errors) As(target interface{}) bool {
+	t, ok := target.(*Error)
+	if !ok || len(e) == 0 {
+		return false
+	}
+	*t = e[0]
+	return true
+}
+
+// ByCode returns the errors that have the given code in their extensions
+func (e Errors) ByCode(code string) Errors {
+	found := Errors{}
+	for _, err := range e {
+		if err.Code() == code {
+			found = append(found, err)
+		}
+	}
+	return found
+}
+
+// HasCode reports whether any of the errors have the given code in their extensions
+func (e Errors) HasCode(code string) bool {
+	return len(e.ByCode(code)) > 0
+}
+
+// Paths returns the paths of the response fields the errors were raised for, in the form returned by
+// Error.PathString. The server sets these fields, or their closest nullable parent, to null.
+func (e Errors) Paths() []string {
+	paths := []string{}
+	for _, err := range e {
+		if len(err.Path) > 0 {
+			paths = append(paths, err.PathString())
+		}
+	}
+	return paths
+}
+
+// ForPath returns the errors raised for the response field at path or any field below it. The path is given as
+// response names and list indices, e.g. ForPath("hero", "friends", 0).
+func (e Errors) ForPath(path ...interface{}) Errors {
+	found := Errors{}
+	for _, err := range e {
+		if len(err.Path) > 0 && err.hasPrefix(path) {
+			found = append(found, err)
+		}
+	}
+	return found
+}
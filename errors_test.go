@@ -0,0 +1,83 @@
+package graphql
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func codeErr(message string, code string) Error {
+	return Error{
+		Message:    message,
+		Extensions: map[string]interface{}{"code": code},
+	}
+}
+
+func TestErrorsMessage(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("graphql: one", Errors{{Message: "one"}}.Error())
+	assert.Equal("graphql: one; two", Errors{{Message: "one"}, {Message: "two"}}.Error())
+}
+
+func TestErrorCode(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("FORBIDDEN", codeErr("no", "FORBIDDEN").Code())
+	assert.Equal("", Error{Message: "no"}.Code())
+	assert.Equal("", Error{Extensions: map[string]interface{}{"code": 12}}.Code())
+}
+
+func TestErrorsByCode(t *testing.T) {
+	assert := assert.New(t)
+	errs := Errors{
+		codeErr("one", "UNAUTHENTICATED"),
+		codeErr("two", "BAD_USER_INPUT"),
+		codeErr("three", "UNAUTHENTICATED"),
+	}
+	found := errs.ByCode("UNAUTHENTICATED")
+	assert.Len(found, 2)
+	assert.Equal("one", found[0].Message)
+	assert.Equal("three", found[1].Message)
+	assert.Empty(errs.ByCode("INTERNAL"))
+	assert.True(errs.HasCode("BAD_USER_INPUT"))
+	assert.False(errs.HasCode("INTERNAL"))
+}
+
+func TestErrorsWorkWithIsAndAs(t *testing.T) {
+	assert := assert.New(t)
+	var err error = fmt.Errorf("wrapped: %w", Errors{codeErr("one", "UNAUTHENTICATED"), {Message: "two"}})
+
+	assert.True(errors.Is(err, Error{Extensions: map[string]interface{}{"code": "UNAUTHENTICATED"}}))
+	assert.True(errors.Is(err, Error{Message: "two"}))
+	assert.False(errors.Is(err, Error{Message: "three"}))
+	assert.False(errors.Is(err, Error{}))
+
+	errs := Errors{}
+	assert.True(errors.As(err, &errs))
+	assert.Len(errs, 2)
+
+	single := Error{}
+	assert.True(errors.As(err, &single))
+	assert.Equal("one", single.Message)
+	assert.False(Errors{}.As(&single))
+}
+
+func TestErrorPaths(t *testing.T) {
+	assert := assert.New(t)
+	errs := Errors{
+		{Message: "one", Path: []interface{}{"hero", "friends", float64(0), "name"}},
+		{Message: "two", Path: []interface{}{"hero", "friends", float64(1)}},
+		{Message: "three"},
+		{Message: "four", Path: []interface{}{"villain"}},
+	}
+	assert.Equal("hero.friends[0].name", errs[0].PathString())
+	assert.Equal("", errs[2].PathString())
+	assert.Equal([]string{"hero.friends[0].name", "hero.friends[1]", "villain"}, errs.Paths())
+
+	assert.Len(errs.ForPath("hero"), 2)
+	assert.Len(errs.ForPath("hero", "friends", 0), 1)
+	assert.Equal("two", errs.ForPath("hero", "friends", 1)[0].Message)
+	assert.Empty(errs.ForPath("hero", "enemies"))
+	assert.Len(errs.ForPath(), 3)
+}
@@ -0,0 +1,165 @@
+package graphql
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const (
+	inlineFragmentPrefix = "... on "
+	typenameField        = "__typename"
+)
+
+// parseInlineFragment reads a gql tag of the form "... on Droid" and returns the type condition
+func parseInlineFragment(tag string) (string, bool) {
+	tag = strings.TrimSpace(tag)
+	if !strings.HasPrefix(tag, "...") {
+		return "", false
+	}
+	tag = strings.TrimSpace(strings.TrimPrefix(tag, "..."))
+	if !strings.HasPrefix(tag, "on ") {
+		return "", false
+	}
+	onType := strings.TrimSpace(strings.TrimPrefix(tag, "on "))
+	return onType, onType != ""
+}
+
+// fragmentField returns the type condition of a struct field tagged as an inline fragment
+func fragmentField(field reflect.StructField) (string, bool) {
+	tag, ok := field.Tag.Lookup("gql")
+	if !ok {
+		return "", false
+	}
+	return parseInlineFragment(strings.Split(tag, ",")[0])
+}
+
+// fragmentTypes caches whether a type has inline fragments anywhere in it
+var fragmentTypes = sync.Map{}
+
+// hasFragments reports whether tp, or any type reachable from it, has a field tagged as an inline fragment
+func hasFragments(tp reflect.Type) bool {
+	if cached, ok := fragmentTypes.Load(tp); ok {
+		return cached.(bool)
+	}
+	found := searchFragments(tp, map[reflect.Type]bool{})
+	fragmentTypes.Store(tp, found)
+	return found
+}
+
+func searchFragments(tp reflect.Type, visited map[reflect.Type]bool) bool {
+	switch tp.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return searchFragments(tp.Elem(), visited)
+	case reflect.Struct:
+		if visited[tp] {
+			return false
+		}
+		visited[tp] = true
+		for i := 0; i < tp.NumField(); i++ {
+			field := tp.Field(i)
+			if _, ok := fragmentField(field); ok {
+				return true
+			}
+			if searchFragments(field.Type, visited) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fillFragments walks the decoded value together with the raw json it was decoded from and fills the inline
+// fragment fields. Only the fragment whose type condition matches the __typename of the object is set, the others
+// are left as zero values.
+func fillFragments(raw json.RawMessage, val reflect.Value) error {
+	switch val.Kind() {
+	case reflect.Ptr:
+		if val.IsNil() {
+			return nil
+		}
+		return fillFragments(raw, val.Elem())
+	case reflect.Slice, reflect.Array:
+		items := []json.RawMessage{}
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil
+		}
+		for i := 0; i < val.Len() && i < len(items); i++ {
+			if err := fillFragments(items[i], val.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		return fillStructFragments(raw, val)
+	}
+	return nil
+}
+
+func fillStructFragments(raw json.RawMessage, val reflect.Value) error {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil
+	}
+	typename := ""
+	if rawName, ok := fields[typenameField]; ok {
+		json.Unmarshal(rawName, &typename)
+	}
+	tp := val.Type()
+	for i := 0; i < tp.NumField(); i++ {
+		field := tp.Field(i)
+		if field.PkgPath != "" || !val.Field(i).CanSet() {
+			continue
+		}
+		fieldVal := val.Field(i)
+		if onType, ok := fragmentField(field); ok {
+			fieldVal.Set(reflect.Zero(field.Type))
+			if onType != typename {
+				continue
+			}
+			target := reflect.New(field.Type)
+			if err := json.Unmarshal(raw, target.Interface()); err != nil {
+				return err
+			}
+			if err := fillFragments(raw, target.Elem()); err != nil {
+				return err
+			}
+			fieldVal.Set(target.Elem())
+			continue
+		}
+		if field.Anonymous && strings.Split(field.Tag.Get("json"), ",")[0] == "" && isStruct(field.Type) {
+			if err := fillFragments(raw, fieldVal); err != nil {
+				return err
+			}
+			continue
+		}
+		if fieldRaw, ok := lookupField(fields, responseKey(field)); ok {
+			if err := fillFragments(fieldRaw, fieldVal); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// responseKey returns the key a struct field is read from in the response
+func responseKey(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// lookupField finds the value of a key the same way encoding/json does, preferring an exact match
+func lookupField(fields map[string]json.RawMessage, key string) (json.RawMessage, bool) {
+	if value, ok := fields[key]; ok {
+		return value, true
+	}
+	for name, value := range fields {
+		if strings.EqualFold(name, key) {
+			return value, true
+		}
+	}
+	return nil, false
+}
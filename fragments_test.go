@@ -0,0 +1,274 @@
+package graphql
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type droidFields struct {
+	PrimaryFunction string `json:"primaryFunction"`
+}
+
+type humanFields struct {
+	Height float64 `json:"height"`
+}
+
+type character struct {
+	Name  string       `json:"name"`
+	Droid *droidFields `gql:"... on Droid"`
+	Human humanFields  `gql:"... on Human"`
+}
+
+type heroQuery struct {
+	Hero   character   `json:"hero" gql_params:"episode:Episode"`
+	Search []character `json:"search"`
+}
+
+func TestParseInlineFragment(t *testing.T) {
+	assert := assert.New(t)
+	onType, ok := parseInlineFragment("... on Droid")
+	assert.True(ok)
+	assert.Equal("Droid", onType)
+	onType, ok = parseInlineFragment("...on  Human ")
+	assert.True(ok)
+	assert.Equal("Human", onType)
+	_, ok = parseInlineFragment("name")
+	assert.False(ok)
+	_, ok = parseInlineFragment("... on ")
+	assert.False(ok)
+}
+
+func TestMarshalsInlineFragments(t *testing.T) {
+	realQ := `{
+    hero{
+        __typename
+        name
+        ... on Droid{
+            primaryFunction
+        }
+        ... on Human{
+            height
+        }
+    }
+}
+`
+	assert := assert.New(t)
+	m, err := Marshal(&struct {
+		Hero character `json:"hero"`
+	}{})
+	assert.NoError(err)
+	assert.Equal(noSpaces(realQ), noSpaces(m.String()))
+}
+
+func TestDoesNotAddTypenameTwice(t *testing.T) {
+	assert := assert.New(t)
+	m, err := Marshal(&struct {
+		Hero struct {
+			Typename string       `json:"__typename"`
+			Droid    *droidFields `gql:"... on Droid"`
+		} `json:"hero"`
+	}{})
+	assert.NoError(err)
+	assert.Equal(1, strings.Count(m.String(), "__typename"))
+}
+
+func TestDecodesMatchingFragment(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`{"data":{
+			"hero":{"__typename":"Droid","name":"R2-D2","primaryFunction":"Astromech"},
+			"search":[
+				{"__typename":"Human","name":"Luke","height":1.72},
+				{"__typename":"Droid","name":"C-3PO","primaryFunction":"Protocol"},
+				{"__typename":"Starship","name":"Falcon"}
+			]
+		}}`))
+	}))
+	defer server.Close()
+	query := &heroQuery{Hero: character{Human: humanFields{Height: 2}}}
+	_, err := NewClient(NewSimpleHTTPTransport(server.URL)).NewRequest().Query(query).Send()
+	assert.NoError(err)
+
+	assert.Equal("R2-D2", query.Hero.Name)
+	assert.Equal(&droidFields{PrimaryFunction: "Astromech"}, query.Hero.Droid)
+	assert.Equal(humanFields{}, query.Hero.Human)
+
+	assert.Len(query.Search, 3)
+	assert.Nil(query.Search[0].Droid)
+	assert.Equal(1.72, query.Search[0].Human.Height)
+	assert.Equal("Protocol", query.Search[1].Droid.PrimaryFunction)
+	assert.Equal(humanFields{}, query.Search[1].Human)
+	assert.Equal("Falcon", query.Search[2].Name)
+	assert.Nil(query.Search[2].Droid)
+}
+
+func TestHasFragments(t *testing.T) {
+	assert := assert.New(t)
+	type node struct {
+		Name     string  `json:"name"`
+		Children []*node `json:"children"`
+	}
+	assert.True(hasFragments(reflect.TypeOf(&heroQuery{})))
+	assert.False(hasFragments(reflect.TypeOf(&node{})))
+	assert.False(hasFragments(reflect.TypeOf(&testExample{})))
+}
+
+type userFields struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (userFields) GqlFragmentOn() string {
+	return "User"
+}
+
+type postFields struct {
+	Title   string     `json:"title"`
+	Author  userFields `json:"author"`
+	Comment struct {
+		Text string `json:"text"`
+	} `json:"comment" gql_params:"first:Int"`
+}
+
+func (*postFields) GqlFragmentOn() string {
+	return "Post"
+}
+
+func TestMarshalsNamedFragments(t *testing.T) {
+	realQ := `{
+    me{
+        ...userFields
+    }
+    friends{
+        ...userFields
+    }
+    posts{
+        ...postFields
+    }
+}
+fragment userFields on User{
+    id
+    name
+}
+fragment postFields on Post{
+    title
+    author{
+        ...userFields
+    }
+    comment{
+        text
+    }
+}
+`
+	assert := assert.New(t)
+	m, err := Marshal(&struct {
+		Me      userFields    `json:"me"`
+		Friends []*userFields `json:"friends"`
+		Posts   []postFields  `json:"posts"`
+	}{})
+	assert.NoError(err)
+	assert.Equal(noSpaces(realQ), noSpaces(m.String()))
+}
+
+func TestSpreadsEmbeddedFragments(t *testing.T) {
+	realQ := `{
+    me{
+        ...userFields
+        email
+    }
+}
+fragment userFields on User{
+    id
+    name
+}
+`
+	assert := assert.New(t)
+	m, err := Marshal(&struct {
+		Me struct {
+			userFields
+			Email string `json:"email"`
+		} `json:"me"`
+	}{})
+	assert.NoError(err)
+	assert.Equal(noSpaces(realQ), noSpaces(m.String()))
+}
+
+func TestDeduplicatesFragmentNames(t *testing.T) {
+	assert := assert.New(t)
+	m := NewMarshaler()
+	m.fragmentNames[reflect.TypeOf(postFields{})] = "userFields"
+	assert.Equal("userFields2", m.fragmentName(reflect.TypeOf(userFields{})))
+	m.fragmentNames[reflect.TypeOf(droidFields{})] = "userFields2"
+	assert.Equal("userFields3", m.fragmentName(reflect.TypeOf(userFields{})))
+	assert.Equal("humanFields", m.fragmentName(reflect.TypeOf(humanFields{})))
+}
+
+func TestStructEmbeddingAFragmentIsNotAFragment(t *testing.T) {
+	assert := assert.New(t)
+	type extendedUser struct {
+		userFields
+		Email string `json:"email"`
+	}
+	assert.True(isFragment(reflect.TypeOf(userFields{})))
+	assert.True(isFragment(reflect.TypeOf(postFields{})))
+	assert.False(isFragment(reflect.TypeOf(extendedUser{})))
+	assert.False(isFragment(reflect.TypeOf(droidFields{})))
+}
+
+func TestDeclaresVariablesUsedInFragments(t *testing.T) {
+	assert := assert.New(t)
+	query := newReq().Query(&struct {
+		Posts []postFields `json:"posts"`
+	}{}).WithVariable("first", 3).GetQuery()
+	assert.True(strings.HasPrefix(query, "query($first:Int){"))
+	assert.Contains(query, "comment(first:$first){")
+}
+
+type recursiveUserFields struct {
+	Name    string                `json:"name"`
+	Friends []recursiveUserFields `json:"friends" gql:"depth=2"`
+}
+
+func (recursiveUserFields) GqlFragmentOn() string {
+	return "User"
+}
+
+type unlimitedUserFields struct {
+	Name    string                `json:"name"`
+	Friends []unlimitedUserFields `json:"friends"`
+}
+
+func (unlimitedUserFields) GqlFragmentOn() string {
+	return "User"
+}
+
+func TestRecursiveFragmentsAreUnrolled(t *testing.T) {
+	realQ := `{
+    me{
+        ...recursiveUserFields
+    }
+}
+fragment recursiveUserFields on User{
+    name
+    friends{
+        name
+    }
+}
+`
+	assert := assert.New(t)
+	m, err := Marshal(&struct {
+		Me recursiveUserFields `json:"me"`
+	}{})
+	assert.NoError(err)
+	assert.Equal(realQ, m.String())
+
+	req := newReq().Query(&struct {
+		Me unlimitedUserFields `json:"me"`
+	}{})
+	assert.EqualError(req.Err(), `Me.Friends: graphql.unlimitedUserFields is recursive, limit how deep it is unrolled with gql:"depth=N" or Marshaler.MaxDepth`)
+}
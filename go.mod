@@ -3,6 +3,7 @@ module github.com/shuttl-io/go-graphql-client
 go 1.13
 
 require (
+	github.com/gorilla/websocket v1.4.2
 	github.com/machinebox/graphql v0.2.2
 	github.com/matryer/is v1.4.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
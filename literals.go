@@ -0,0 +1,68 @@
+package graphql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// literalArg is an argument sent with a constant value written in graphql syntax, e.g. first: 10
+type literalArg struct {
+	name  string
+	value string
+}
+
+// parseLiteralArgs reads a gql_args tag. Arguments are separated by commas and their values are written the way
+// they are sent: scalars, enums, lists and input objects, e.g. first:10,orderBy:{field:NAME,direction:ASC}.
+func parseLiteralArgs(tag string) ([]literalArg, error) {
+	entries, err := splitTopLevel(tag)
+	if err != nil {
+		return nil, err
+	}
+	args := []literalArg{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		colon := strings.Index(entry, ":")
+		if colon <= 0 || strings.TrimSpace(entry[colon+1:]) == "" {
+			return nil, fmt.Errorf("argument %q should be written as name:value", entry)
+		}
+		args = append(args, literalArg{
+			name:  strings.TrimSpace(entry[:colon]),
+			value: strings.TrimSpace(entry[colon+1:]),
+		})
+	}
+	return args, nil
+}
+
+// splitTopLevel splits the value at the commas that are not inside of a list, an input object or a string
+func splitTopLevel(value string) ([]string, error) {
+	parts := []string{}
+	depth := 0
+	inString := false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unexpected %q in %q", c, value)
+			}
+		case c == ',' && depth == 0:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	if depth != 0 || inString {
+		return nil, fmt.Errorf("unbalanced brackets or quotes in %q", value)
+	}
+	return append(parts, value[start:]), nil
+}
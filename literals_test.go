@@ -0,0 +1,70 @@
+package graphql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLiteralArgs(t *testing.T) {
+	assert := assert.New(t)
+	args, err := parseLiteralArgs(`first: 10, orderBy:{field:NAME,direction:ASC}, ids:["a,b", "c\"]"], status:ACTIVE`)
+	assert.NoError(err)
+	assert.Equal([]literalArg{
+		{name: "first", value: "10"},
+		{name: "orderBy", value: "{field:NAME,direction:ASC}"},
+		{name: "ids", value: `["a,b", "c\"]"]`},
+		{name: "status", value: "ACTIVE"},
+	}, args)
+}
+
+func TestParseLiteralArgsErrors(t *testing.T) {
+	assert := assert.New(t)
+	_, err := parseLiteralArgs("first")
+	assert.EqualError(err, `argument "first" should be written as name:value`)
+	_, err = parseLiteralArgs("first:")
+	assert.Error(err)
+	_, err = parseLiteralArgs("orderBy:{field:NAME")
+	assert.Error(err)
+	_, err = parseLiteralArgs("orderBy:field:NAME}")
+	assert.Error(err)
+	_, err = parseLiteralArgs(`name:"open`)
+	assert.Error(err)
+}
+
+type literalQuery struct {
+	Users []struct {
+		Name string `json:"name"`
+	} `json:"users" gql_args:"first:10,orderBy:{field:NAME,direction:ASC}" gql_params:"status:Status"`
+	Posts []struct {
+		Title string `json:"title"`
+	} `json:"posts" gql_args:"first:5" gql_params:"first:Int"`
+}
+
+func TestRendersLiteralArgs(t *testing.T) {
+	assert := assert.New(t)
+	query := newReq().Query(&literalQuery{}).GetQuery()
+	assert.True(strings.HasPrefix(query, "query{"), query)
+	assert.Contains(query, "users(first:10, orderBy:{field:NAME,direction:ASC}){")
+	assert.Contains(query, "posts(first:5){")
+}
+
+func TestMixesLiteralAndVariableArgs(t *testing.T) {
+	assert := assert.New(t)
+	query := newReq().Query(&literalQuery{}).
+		WithVariable("status", "ACTIVE").
+		WithVariable("first", 20).
+		GetQuery()
+	assert.True(strings.HasPrefix(query, "query($status:Status, $first:Int){"), query)
+	assert.Contains(query, "users(first:10, orderBy:{field:NAME,direction:ASC}, status:$status){")
+	assert.Contains(query, "posts(first:$first){")
+}
+
+func TestMarshalReturnsLiteralArgErrors(t *testing.T) {
+	assert := assert.New(t)
+	_, err := Marshal(&struct {
+		Users []string `json:"users" gql_args:"first"`
+	}{})
+	assert.EqualError(err, `Users: argument "first" should be written as name:value`)
+}
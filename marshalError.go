@@ -0,0 +1,45 @@
+package graphql
+
+import "strings"
+
+// MarshalError is returned when an object can't be marshaled to a graphql query. Path is the path of the go field
+// that failed, e.g. Hero.Friends[].Age, with [] standing for the elements of a slice.
+type MarshalError struct {
+	Path string
+	Err  error
+}
+
+func (e *MarshalError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error the field failed with
+func (e *MarshalError) Unwrap() error {
+	return e.Err
+}
+
+// wrapField adds the name of a struct field to the path of err
+func wrapField(name string, err error) error {
+	if marshalErr, ok := err.(*MarshalError); ok {
+		if strings.HasPrefix(marshalErr.Path, "[") {
+			marshalErr.Path = name + marshalErr.Path
+		} else {
+			marshalErr.Path = name + "." + marshalErr.Path
+		}
+		return marshalErr
+	}
+	return &MarshalError{Path: name, Err: err}
+}
+
+// wrapElem adds the elements of a slice to the path of err
+func wrapElem(err error) error {
+	if marshalErr, ok := err.(*MarshalError); ok {
+		if strings.HasPrefix(marshalErr.Path, "[") {
+			marshalErr.Path = "[]" + marshalErr.Path
+		} else {
+			marshalErr.Path = "[]." + marshalErr.Path
+		}
+		return marshalErr
+	}
+	return &MarshalError{Path: "[]", Err: err}
+}
@@ -0,0 +1,109 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type brokenFriend struct {
+	Name string      `json:"name"`
+	Age  chan string `json:"age"`
+}
+
+type brokenQuery struct {
+	Hero struct {
+		Friends []brokenFriend `json:"friends"`
+	} `json:"hero"`
+}
+
+type failingMarshaler struct{}
+
+func (failingMarshaler) MarshalGql(m *Marshaler) ([]*QueryPart, error) {
+	return nil, errors.New("boom")
+}
+
+func TestMarshalErrorsHaveTheFieldPath(t *testing.T) {
+	assert := assert.New(t)
+	_, err := Marshal(&brokenQuery{})
+	assert.EqualError(err, "Hero.Friends[].Age: unsupported kind chan, it can't be decoded from json")
+	marshalErr := &MarshalError{}
+	assert.True(errors.As(err, &marshalErr))
+	assert.Equal("Hero.Friends[].Age", marshalErr.Path)
+
+	_, err = Marshal(&struct {
+		Matrix [][]func() `json:"matrix"`
+	}{})
+	assert.EqualError(err, "Matrix[][]: unsupported kind func, it can't be decoded from json")
+
+	_, err = Marshal(&struct {
+		Custom struct {
+			Failing failingMarshaler `json:"failing"`
+		} `json:"custom"`
+	}{})
+	assert.EqualError(err, "Custom.Failing: boom")
+}
+
+func TestMalformedParamsAreErrors(t *testing.T) {
+	assert := assert.New(t)
+	_, err := Marshal(&struct {
+		Hero struct {
+			Name string `json:"name" gql_params:":String"`
+		} `json:"hero"`
+	}{})
+	assert.EqualError(err, `Hero.Name: gql_params entry ":String" has no argument name`)
+}
+
+func TestSendReturnsMarshalErrors(t *testing.T) {
+	assert := assert.New(t)
+	transport := &mockTransport2{}
+	req := NewClient(transport).NewRequest().Query(&brokenQuery{})
+	assert.Error(req.Err())
+	_, err := req.Send()
+	assert.EqualError(err, "Hero.Friends[].Age: unsupported kind chan, it can't be decoded from json")
+	assert.EqualError(req.Subscribe(context.Background(), nil), err.Error())
+	assert.Equal(0, transport.calledNum)
+}
+
+func TestNilObjectIsAnError(t *testing.T) {
+	assert := assert.New(t)
+	transport := &mockTransport2{}
+	req := NewClient(transport).NewRequest().Query(nil)
+	assert.EqualError(req.Err(), "object should be a pointer")
+	_, err := req.Send()
+	assert.EqualError(err, "object should be a pointer")
+	assert.Equal(0, transport.calledNum)
+	_, err = Marshal(nil)
+	assert.EqualError(err, "object should be a pointer")
+}
+
+func TestSendReturnsVariablesWithoutType(t *testing.T) {
+	assert := assert.New(t)
+	req := newReq().Query(&struct {
+		User struct {
+			Name string `json:"name"`
+		} `json:"user" gql_params:"id"`
+	}{})
+	assert.NoError(req.Err())
+	req.WithVariable("id", map[string]string{})
+	assert.EqualError(req.Err(), "variable $id has no type in gql_params: cannot infer the graphql type of map[string]string, implement GqlTyper or use RegisterType")
+	req.WithVariable("id", "1")
+	assert.NoError(req.Err())
+}
+
+func TestBatchReturnsMarshalErrors(t *testing.T) {
+	assert := assert.New(t)
+	sent := 0
+	transport := TransportFunc(func(ctx context.Context, req Request) (Response, error) {
+		sent++
+		return Response{Response: req.GetInterface()}, nil
+	})
+	c := NewClient(transport)
+	results, err := c.Batch(c.NewRequest().Query(&batchQuery{}), c.NewRequest().Query(&brokenQuery{}))
+	assert.NoError(err)
+	assert.Equal(1, sent)
+	assert.NoError(results[0].Err)
+	assert.Error(results[1].Err)
+}
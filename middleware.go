@@ -0,0 +1,156 @@
+package graphql
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Middleware wraps a Transport to add behaviour around sending a request, like adding headers, logging or
+// retrying. Middlewares are added to a client with Client.Use. A middleware whose transport also implements
+// SubscriptionTransport wraps the subscriptions of the client too, see NewMiddlewareTransport.
+type Middleware func(next Transport) Transport
+
+// TransportFunc turns a function into a Transport. It implements ContextTransport so the context is passed along
+// when the request is sent with SendContext.
+type TransportFunc func(ctx context.Context, req Request) (Response, error)
+
+// Transport calls the function with a background context
+func (f TransportFunc) Transport(req Request) (Response, error) {
+	return f(context.Background(), req)
+}
+
+// TransportContext calls the function
+func (f TransportFunc) TransportContext(ctx context.Context, req Request) (Response, error) {
+	return f(ctx, req)
+}
+
+// TransportWithContext sends the request with the transport, handing it the context if the transport implements
+// ContextTransport. Middlewares use this to call the next transport.
+func TransportWithContext(ctx context.Context, transport Transport, req Request) (Response, error) {
+	if t, ok := transport.(ContextTransport); ok {
+		return t.TransportContext(ctx, req)
+	}
+	return transport.Transport(req)
+}
+
+// SubscribeFunc is the function that starts a subscription in a transport made with NewMiddlewareTransport
+type SubscribeFunc func(ctx context.Context, req Request, handler SubscriptionHandler) error
+
+// middlewareTransport is a TransportFunc that can also start subscriptions
+type middlewareTransport struct {
+	TransportFunc
+	subscribe SubscribeFunc
+}
+
+func (m middlewareTransport) Subscribe(ctx context.Context, req Request, handler SubscriptionHandler) error {
+	return m.subscribe(ctx, req, handler)
+}
+
+// NewMiddlewareTransport returns a transport that sends requests with send and starts subscriptions with subscribe.
+// Middlewares return one to wrap the subscriptions of the client as well as its requests.
+func NewMiddlewareTransport(send TransportFunc, subscribe SubscribeFunc) Transport {
+	return middlewareTransport{TransportFunc: send, subscribe: subscribe}
+}
+
+// SubscribeWithTransport starts the subscription on the transport, or returns ErrSubscriptionsNotSupported if the
+// transport does not implement SubscriptionTransport. Middlewares use this to call the next transport.
+func SubscribeWithTransport(ctx context.Context, transport Transport, req Request, handler SubscriptionHandler) error {
+	t, ok := transport.(SubscriptionTransport)
+	if !ok {
+		return ErrSubscriptionsNotSupported
+	}
+	return t.Subscribe(ctx, req, handler)
+}
+
+// chainedTransport is the transport a client with middlewares hands to its requests. Sends go through all the
+// middlewares, subscriptions go through the middlewares that support them, see NewMiddlewareTransport.
+type chainedTransport struct {
+	next          Transport
+	subscriptions Transport
+}
+
+func (c *chainedTransport) Transport(req Request) (Response, error) {
+	return c.TransportContext(context.Background(), req)
+}
+
+func (c *chainedTransport) TransportContext(ctx context.Context, req Request) (Response, error) {
+	return TransportWithContext(ctx, c.next, req)
+}
+
+func (c *chainedTransport) Subscribe(ctx context.Context, req Request, handler SubscriptionHandler) error {
+	return SubscribeWithTransport(ctx, c.subscriptions, req, handler)
+}
+
+type headersKey struct{}
+
+// ContextWithHeaders returns a copy of ctx that carries headers. The transports in this package add these headers
+// to the http requests they make, on top of the headers set on the transport.
+func ContextWithHeaders(ctx context.Context, headers http.Header) context.Context {
+	merged := headersFromContext(ctx).Clone()
+	if merged == nil {
+		merged = http.Header{}
+	}
+	for key, values := range headers {
+		for _, value := range values {
+			merged.Add(key, value)
+		}
+	}
+	return context.WithValue(ctx, headersKey{}, merged)
+}
+
+// headersFromContext returns the headers added with ContextWithHeaders
+func headersFromContext(ctx context.Context) http.Header {
+	headers, _ := ctx.Value(headersKey{}).(http.Header)
+	return headers
+}
+
+// addHeaders adds the headers of the transport and the headers carried by the context onto the request
+func addHeaders(httpReq *http.Request, headers map[string][]string) {
+	for key, value := range headers {
+		for _, headerVal := range value {
+			httpReq.Header.Add(key, headerVal)
+		}
+	}
+	for key, value := range headersFromContext(httpReq.Context()) {
+		for _, headerVal := range value {
+			httpReq.Header.Add(key, headerVal)
+		}
+	}
+}
+
+// Headers returns a middleware that adds headers to every request and subscription. It works with any transport
+// in this package by adding the headers to the context, see ContextWithHeaders.
+func Headers(headers http.Header) Middleware {
+	return func(next Transport) Transport {
+		return NewMiddlewareTransport(func(ctx context.Context, req Request) (Response, error) {
+			return TransportWithContext(ContextWithHeaders(ctx, headers), next, req)
+		}, func(ctx context.Context, req Request, handler SubscriptionHandler) error {
+			return SubscribeWithTransport(ContextWithHeaders(ctx, headers), next, req, handler)
+		})
+	}
+}
+
+// Timing returns a middleware that calls observe with how long every request took and the error it returned
+func Timing(observe func(req Request, duration time.Duration, err error)) Middleware {
+	return func(next Transport) Transport {
+		return TransportFunc(func(ctx context.Context, req Request) (Response, error) {
+			start := time.Now()
+			resp, err := TransportWithContext(ctx, next, req)
+			observe(req, time.Since(start), err)
+			return resp, err
+		})
+	}
+}
+
+// Logging returns a middleware that logs every request with its duration and error to logger
+func Logging(logger *log.Logger) Middleware {
+	return Timing(func(req Request, duration time.Duration, err error) {
+		if err != nil {
+			logger.Printf("graphql: %s failed after %s: %s", req.GetOperationType(), duration, err)
+			return
+		}
+		logger.Printf("graphql: %s took %s", req.GetOperationType(), duration)
+	})
+}
@@ -0,0 +1,229 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func recordingMiddleware(name string, calls *[]string) Middleware {
+	return func(next Transport) Transport {
+		return TransportFunc(func(ctx context.Context, req Request) (Response, error) {
+			*calls = append(*calls, name+" before")
+			resp, err := TransportWithContext(ctx, next, req)
+			*calls = append(*calls, name+" after")
+			return resp, err
+		})
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	assert := assert.New(t)
+	calls := []string{}
+	transport := TransportFunc(func(ctx context.Context, req Request) (Response, error) {
+		calls = append(calls, "transport")
+		return Response{}, nil
+	})
+	c := NewClient(transport).
+		Use(recordingMiddleware("first", &calls)).
+		Use(recordingMiddleware("second", &calls), recordingMiddleware("third", &calls))
+	_, err := c.NewRequest().Query(&testQuery{}).Send()
+	assert.NoError(err)
+	assert.Equal([]string{
+		"first before",
+		"second before",
+		"third before",
+		"transport",
+		"third after",
+		"second after",
+		"first after",
+	}, calls)
+}
+
+func TestMiddlewarePassesContext(t *testing.T) {
+	assert := assert.New(t)
+	var seen context.Context
+	transport := TransportFunc(func(ctx context.Context, req Request) (Response, error) {
+		seen = ctx
+		return Response{}, nil
+	})
+	c := NewClient(transport).Use(recordingMiddleware("first", &[]string{}))
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	c.NewRequest().Query(&testQuery{}).SendContext(ctx)
+	assert.Equal("value", seen.Value(ctxKey{}))
+}
+
+func TestMiddlewareWrapsPlainTransport(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockTransport2{}
+	c := NewClient(m).Use(recordingMiddleware("first", &[]string{}))
+	c.NewRequest().Query(&testQuery{}).Send()
+	assert.Equal(1, m.calledNum)
+}
+
+func TestHeadersMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal("application/json", req.Header.Get("Content-Type"))
+		assert.Equal([]string{"Bearer token"}, req.Header["Authorization"])
+		assert.Equal([]string{"one", "two"}, req.Header["X-Trace"])
+		rw.Write([]byte(`{"data":{"message":"Good"}}`))
+	}))
+	defer server.Close()
+	c := NewClient(NewSimpleHTTPTransport(server.URL)).
+		Use(Headers(http.Header{"Authorization": {"Bearer token"}, "X-Trace": {"one"}})).
+		Use(Headers(http.Header{"X-Trace": {"two"}}))
+	msg := &testQuery{}
+	_, err := c.NewRequest().Query(msg).Send()
+	assert.NoError(err)
+	assert.Equal("Good", msg.Message)
+}
+
+func TestContextWithHeadersDoesNotChangeParent(t *testing.T) {
+	assert := assert.New(t)
+	parent := ContextWithHeaders(context.Background(), http.Header{"X-One": {"1"}})
+	child := ContextWithHeaders(parent, http.Header{"X-One": {"2"}})
+	assert.Equal([]string{"1"}, headersFromContext(parent)["X-One"])
+	assert.Equal([]string{"1", "2"}, headersFromContext(child)["X-One"])
+	assert.Nil(headersFromContext(context.Background()))
+}
+
+func TestTimingMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	transport := TransportFunc(func(ctx context.Context, req Request) (Response, error) {
+		time.Sleep(5 * time.Millisecond)
+		return Response{}, errors.New("boom")
+	})
+	var observed time.Duration
+	var observedErr error
+	var observedReq Request
+	c := NewClient(transport).Use(Timing(func(req Request, duration time.Duration, err error) {
+		observedReq, observed, observedErr = req, duration, err
+	}))
+	req := c.NewRequest().Mutation(&testQuery{})
+	req.Send()
+	assert.True(observed >= 5*time.Millisecond)
+	assert.EqualError(observedErr, "boom")
+	assert.Equal(req, observedReq)
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	fail := false
+	transport := TransportFunc(func(ctx context.Context, req Request) (Response, error) {
+		if fail {
+			return Response{}, errors.New("boom")
+		}
+		return Response{}, nil
+	})
+	buf := &bytes.Buffer{}
+	c := NewClient(transport).Use(Logging(log.New(buf, "", 0)))
+	c.NewRequest().Query(&testQuery{}).Send()
+	assert.Contains(buf.String(), "graphql: query took ")
+	buf.Reset()
+	fail = true
+	c.NewRequest().Mutation(&testQuery{}).Send()
+	assert.Contains(buf.String(), "graphql: mutation failed after ")
+	assert.Contains(buf.String(), ": boom")
+}
+
+// recordingSubscriber is a transport that records the headers on the context of the subscriptions it starts
+type recordingSubscriber struct {
+	TransportFunc
+	headers http.Header
+}
+
+func (r *recordingSubscriber) Subscribe(ctx context.Context, req Request, handler SubscriptionHandler) error {
+	r.headers = headersFromContext(ctx)
+	return nil
+}
+
+func TestHeadersWrapSubscriptions(t *testing.T) {
+	assert := assert.New(t)
+	calls := []string{}
+	subscriber := &recordingSubscriber{}
+	c := NewClient(subscriber).
+		Use(Headers(http.Header{"Authorization": {"Bearer token"}})).
+		Use(recordingMiddleware("first", &calls)).
+		Use(Headers(http.Header{"X-Trace": {"abc"}}))
+	err := c.NewRequest().Subscription(&testSubscription{}).Subscribe(context.Background(), func(resp Response, err error) error {
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal("Bearer token", subscriber.headers.Get("Authorization"))
+	assert.Equal("abc", subscriber.headers.Get("X-Trace"))
+	assert.Empty(calls)
+}
+
+func TestCustomMiddlewareWrapsSubscriptions(t *testing.T) {
+	assert := assert.New(t)
+	calls := []string{}
+	c := NewClient(&recordingSubscriber{}).Use(func(next Transport) Transport {
+		return NewMiddlewareTransport(func(ctx context.Context, req Request) (Response, error) {
+			return TransportWithContext(ctx, next, req)
+		}, func(ctx context.Context, req Request, handler SubscriptionHandler) error {
+			calls = append(calls, "subscribe")
+			return SubscribeWithTransport(ctx, next, req, handler)
+		})
+	})
+	err := c.NewRequest().Subscription(&testSubscription{}).Subscribe(context.Background(), func(resp Response, err error) error {
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal([]string{"subscribe"}, calls)
+
+	c = NewClient(&mockTransport{}).Use(Headers(http.Header{"X-Trace": {"abc"}}))
+	err = c.NewRequest().Subscription(&testSubscription{}).Subscribe(context.Background(), func(resp Response, err error) error {
+		return nil
+	})
+	assert.Equal(ErrSubscriptionsNotSupported, err)
+}
+
+func TestHeadersReachWebSocketSubscriptions(t *testing.T) {
+	assert := assert.New(t)
+	var seen http.Header
+	state := &wsServerState{results: []string{`{"data":{"messageAdded":{"text":"one"}}}`}}
+	server := newWsServer(t, state, ProtocolGraphqlTransportWS)
+	defer server.Close()
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		seen = req.Header.Clone()
+		handler.ServeHTTP(rw, req)
+	})
+	c := NewClient(NewWebSocketTransport(wsURL(server))).Use(Headers(http.Header{"Authorization": {"Bearer token"}}))
+	err := c.NewRequest().Subscription(&testSubscription{}).Subscribe(context.Background(), func(resp Response, err error) error {
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal("Bearer token", seen.Get("Authorization"))
+}
+
+func TestSubscriptionsSkipSendOnlyMiddlewares(t *testing.T) {
+	assert := assert.New(t)
+	calls := []string{}
+	c := NewClient(&mockTransport{}).Use(recordingMiddleware("first", &calls))
+	err := c.NewRequest().Subscription(&testSubscription{}).Subscribe(context.Background(), func(resp Response, err error) error {
+		return nil
+	})
+	assert.Equal(ErrSubscriptionsNotSupported, err)
+
+	state := &wsServerState{results: []string{`{"data":{"messageAdded":{"text":"one"}}}`}}
+	server := newWsServer(t, state, ProtocolGraphqlTransportWS)
+	defer server.Close()
+	c = NewClient(NewWebSocketTransport(wsURL(server))).Use(recordingMiddleware("first", &calls))
+	texts := []string{}
+	err = c.NewRequest().Subscription(&testSubscription{}).Subscribe(context.Background(), func(resp Response, err error) error {
+		texts = append(texts, resp.Response.(*testSubscription).MessageAdded.Text)
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal([]string{"one"}, texts)
+	assert.Empty(calls)
+}
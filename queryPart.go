@@ -2,6 +2,7 @@ package graphql
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -14,6 +15,18 @@ type QueryPart struct {
 	// Subfield represents other fields, for example in a bigger queries
 	SubFields    []*QueryPart
 	requiredArgs []string
+	// argOrder is the order the arguments were declared in, required args are kept in this order
+	argOrder []string
+	// variables maps arguments to the variable they take their value from when it is not named like the argument
+	variables map[string]string
+	// literalArgs are sent with their constant value. A variable argument with the same name replaces the literal
+	// when the variable is set on the request.
+	literalArgs []literalArg
+	// directives are sent after the arguments. A directive that uses variables is only sent when all of them are
+	// set on the request.
+	directives []*directive
+	// directiveArgs are the variables used by the directives that are set on the request
+	directiveArgs []string
 }
 
 // NewQueryPart creates a new QueryPart
@@ -26,46 +39,269 @@ func NewQueryPart(name string) *QueryPart {
 	}
 }
 
-func (q *QueryPart) markArgAsNeeded(arg string) {
-	if _, ok := q.Arguments[arg]; ok {
-		q.requiredArgs = append(q.requiredArgs, arg)
-	} else if len(q.SubFields) > 0 {
-		for _, sub := range q.SubFields {
-			sub.markArgAsNeeded(arg)
+// hasField reports whether one of the subfields selects the field with the given name
+func (q *QueryPart) hasField(name string) bool {
+	for _, sub := range q.SubFields {
+		if sub.Value == name {
+			return true
 		}
 	}
+	return false
+}
+
+// addArgument declares an argument the field takes with its graphql type
+func (q *QueryPart) addArgument(name string, tp string) {
+	if _, ok := q.Arguments[name]; !ok {
+		q.argOrder = append(q.argOrder, name)
+	}
+	q.Arguments[name] = tp
+}
 
+// addVariableArgument declares an argument that takes its value from a variable with a different name
+func (q *QueryPart) addVariableArgument(name string, tp string, variable string) {
+	q.addArgument(name, tp)
+	if q.variables == nil {
+		q.variables = map[string]string{}
+	}
+	q.variables[name] = variable
+}
+
+// variableFor returns the name of the variable the argument takes its value from
+func (q *QueryPart) variableFor(arg string) string {
+	if variable, ok := q.variables[arg]; ok {
+		return variable
+	}
+	return arg
+}
+
+func (q *QueryPart) isArgRequired(arg string) bool {
+	for _, required := range q.requiredArgs {
+		if required == arg {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *QueryPart) argPosition(arg string) int {
+	for i, name := range q.argOrder {
+		if name == arg {
+			return i
+		}
+	}
+	return len(q.argOrder)
+}
+
+// usesDirectiveArg reports whether one of the directives uses the variable
+func (q *QueryPart) usesDirectiveArg(arg string) bool {
+	for _, d := range q.directives {
+		if _, ok := d.types[arg]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// includesDirective reports whether all the variables the directive uses are set on the request. When needed is
+// nil the variables marked with markArgAsNeeded are used, otherwise the ones in needed.
+func (q *QueryPart) includesDirective(d *directive, needed *set) bool {
+	for _, variable := range d.variables {
+		if needed == nil && !containsString(q.directiveArgs, variable) {
+			return false
+		}
+		if needed != nil && !needed.has(variable) {
+			return false
+		}
+	}
+	return true
+}
+
+// argsFor returns the args that are sent. When needed is nil these are the args marked with markArgAsNeeded,
+// otherwise the ones whose variable is in needed. Using needed leaves the part untouched so it can be shared.
+func (q *QueryPart) argsFor(needed *set) []string {
+	if needed == nil {
+		return q.requiredArgs
+	}
+	args := []string{}
+	for _, arg := range q.argOrder {
+		if needed.has(q.variableFor(arg)) {
+			args = append(args, arg)
+		}
+	}
+	if len(q.argOrder) == len(q.Arguments) {
+		return args
+	}
+	undeclared := []string{}
+	for arg := range q.Arguments {
+		if !containsString(q.argOrder, arg) && needed.has(q.variableFor(arg)) {
+			undeclared = append(undeclared, arg)
+		}
+	}
+	sort.Strings(undeclared)
+	return append(args, undeclared...)
+}
+
+func (q *QueryPart) markArgAsNeeded(arg string) {
+	if q.usesDirectiveArg(arg) && !containsString(q.directiveArgs, arg) {
+		q.directiveArgs = append(q.directiveArgs, arg)
+	}
+	for name := range q.Arguments {
+		if q.variableFor(name) != arg || q.isArgRequired(name) {
+			continue
+		}
+		q.requiredArgs = append(q.requiredArgs, name)
+		sort.SliceStable(q.requiredArgs, func(i, j int) bool {
+			return q.argPosition(q.requiredArgs[i]) < q.argPosition(q.requiredArgs[j])
+		})
+	}
+	for _, sub := range q.SubFields {
+		sub.markArgAsNeeded(arg)
+	}
 }
 
 func (q *QueryPart) collectArgs() []string {
+	return uniqueVariables(q.collectTypedArgs(nil, nil))
+}
+
+// uniqueVariables keeps the first definition of every variable in args, a variable used in several places is
+// declared once
+func uniqueVariables(args []string) []string {
+	declared := newSet()
+	unique := []string{}
+	for _, arg := range args {
+		name := strings.SplitN(arg, ":", 2)[0]
+		if !declared.has(name) {
+			declared.add(name)
+			unique = append(unique, arg)
+		}
+	}
+	return unique
+}
+
+// checkVariableTypes records the type every variable is declared with in types, it fails when a variable is declared
+// with two different types. Args declared without a type take the type of their value and are not checked.
+func (q *QueryPart) checkVariableTypes(types map[string]string) error {
+	check := func(variable string, tp string) error {
+		if declared, ok := types[variable]; ok && declared != tp {
+			return fmt.Errorf("variable $%s is declared as both %s and %s", variable, declared, tp)
+		}
+		types[variable] = tp
+		return nil
+	}
+	for _, arg := range q.argOrder {
+		if tp := q.Arguments[arg]; tp != "" {
+			if err := check(q.variableFor(arg), tp); err != nil {
+				return err
+			}
+		}
+	}
+	for _, d := range q.directives {
+		for _, variable := range d.variables {
+			if err := check(variable, d.types[variable]); err != nil {
+				return err
+			}
+		}
+	}
+	for _, sub := range q.SubFields {
+		if err := sub.checkVariableTypes(types); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectTypedArgs collects the variable definitions, args declared without a type take theirs from inferred.
+// Args whose type is unknown are left out.
+func (q *QueryPart) collectTypedArgs(inferred map[string]string, needed *set) []string {
 	val := []string{}
-	for _, arg := range q.requiredArgs {
-		val = append(val, fmt.Sprintf("$%s:%s", arg, q.Arguments[arg]))
+	for _, arg := range q.argsFor(needed) {
+		variable := q.variableFor(arg)
+		tp := q.Arguments[arg]
+		if tp == "" {
+			tp = inferred[variable]
+		}
+		if tp != "" {
+			val = append(val, fmt.Sprintf("$%s:%s", variable, tp))
+		}
+	}
+	for _, d := range q.directives {
+		if !q.includesDirective(d, needed) {
+			continue
+		}
+		for _, variable := range d.variables {
+			val = append(val, fmt.Sprintf("$%s:%s", variable, d.types[variable]))
+		}
 	}
 	if len(q.SubFields) > 0 {
 		for _, sub := range q.SubFields {
-			val = append(val, sub.collectArgs()...)
+			val = append(val, sub.collectTypedArgs(inferred, needed)...)
 		}
 	}
 	return val
 }
 
+// untypedArgs returns the variables of the sent args that are declared without a type
+func (q *QueryPart) untypedArgs(needed *set) []string {
+	untyped := []string{}
+	for _, arg := range q.argsFor(needed) {
+		if q.Arguments[arg] == "" {
+			untyped = append(untyped, q.variableFor(arg))
+		}
+	}
+	for _, sub := range q.SubFields {
+		untyped = append(untyped, sub.untypedArgs(needed)...)
+	}
+	return untyped
+}
+
+// hasUntypedArgs reports whether the part or its subfields declare an argument without a type
+func (q *QueryPart) hasUntypedArgs() bool {
+	for _, tp := range q.Arguments {
+		if tp == "" {
+			return true
+		}
+	}
+	for _, sub := range q.SubFields {
+		if sub.hasUntypedArgs() {
+			return true
+		}
+	}
+	return false
+}
+
 func (q *QueryPart) buildStr(builder *strings.Builder, level int) *strings.Builder {
+	return q.render(builder, level, nil)
+}
+
+// render writes the part with the args and directives for the variables in needed, see argsFor
+func (q *QueryPart) render(builder *strings.Builder, level int, needed *set) *strings.Builder {
 	builder.WriteString(strings.Repeat(" ", level*4))
 	builder.WriteString(q.Value)
-	if len(q.requiredArgs) > 0 {
-		builder.WriteString("(")
-		str := []string{}
-		for _, arg := range q.requiredArgs {
-			str = append(str, fmt.Sprintf("%s:$%s", arg, arg))
+	args := q.argsFor(needed)
+	str := []string{}
+	for _, arg := range q.literalArgs {
+		if !containsString(args, arg.name) {
+			str = append(str, fmt.Sprintf("%s:%s", arg.name, arg.value))
 		}
+	}
+	for _, arg := range args {
+		str = append(str, fmt.Sprintf("%s:$%s", arg, q.variableFor(arg)))
+	}
+	if len(str) > 0 {
+		builder.WriteString("(")
 		builder.WriteString(strings.Join(str, ", "))
 		builder.WriteString(")")
 	}
+	for _, d := range q.directives {
+		if q.includesDirective(d, needed) {
+			builder.WriteString(" ")
+			builder.WriteString(d.String())
+		}
+	}
 	if len(q.SubFields) > 0 {
 		builder.WriteString("{\n")
 		for _, sub := range q.SubFields {
-			sub.buildStr(builder, level+1)
+			sub.render(builder, level+1, needed)
 		}
 		builder.WriteString(strings.Repeat(" ", level*4))
 		builder.WriteString("}")
@@ -140,3 +140,16 @@ func TestAllTogetherNow(t *testing.T) {
 `, qp.String())
 
 }
+
+func TestMarkingArgsKeepsDeclaredOrder(t *testing.T) {
+	assert := assert.New(t)
+	qp := NewQueryPart("some_string")
+	qp.addArgument("first", "Int")
+	qp.addArgument("second", "String")
+	qp.addArgument("third", "ID")
+	qp.markArgAsNeeded("third")
+	qp.markArgAsNeeded("first")
+	qp.markArgAsNeeded("third")
+	assert.Equal([]string{"first", "third"}, qp.requiredArgs)
+	assert.Equal([]string{"$first:Int", "$third:ID"}, qp.collectArgs())
+}
@@ -1,11 +1,15 @@
 package graphql
 
-import "strings"
+import (
+	"context"
+	"fmt"
+)
 
 type request struct {
 	tp        string
+	name      string
 	retVal    interface{}
-	m         *Marshaler
+	query     *compiledQuery
 	argValues map[string]interface{}
 	err       error
 	transport Transport
@@ -15,7 +19,6 @@ func newReq() *request {
 	return &request{
 		tp:        "",
 		retVal:    nil,
-		m:         NewMarshaler(),
 		argValues: map[string]interface{}{},
 		err:       nil,
 	}
@@ -24,7 +27,8 @@ func newReq() *request {
 func (r *request) makeReq(obj interface{}, tp string) Request {
 	r.tp = tp
 	r.retVal = obj
-	_, r.err = r.m.MarshalToGraphql(obj)
+	r.query = compile(obj)
+	r.err = r.query.err
 	return r
 }
 
@@ -36,6 +40,15 @@ func (r *request) Mutation(object interface{}) Request {
 	return r.makeReq(object, "mutation")
 }
 
+func (r *request) Subscription(object interface{}) Request {
+	return r.makeReq(object, "subscription")
+}
+
+func (r *request) Named(name string) Request {
+	r.name = name
+	return r
+}
+
 func (r *request) WithVariable(name string, value interface{}) Request {
 	r.argValues[name] = value
 	return r
@@ -51,25 +64,78 @@ func (r *request) GetInterface() interface{} {
 }
 
 func (r *request) Send() (Response, error) {
-	return r.transport.Transport(r)
+	return r.SendContext(context.Background())
+}
+
+func (r *request) SendContext(ctx context.Context) (Response, error) {
+	if err := r.Err(); err != nil {
+		return Response{}, err
+	}
+	return TransportWithContext(ctx, r.transport, r)
+}
+
+func (r *request) Subscribe(ctx context.Context, handler SubscriptionHandler) error {
+	if err := r.Err(); err != nil {
+		return err
+	}
+	t, ok := r.transport.(SubscriptionTransport)
+	if !ok {
+		return ErrSubscriptionsNotSupported
+	}
+	return t.Subscribe(ctx, r, handler)
+}
+
+func (r *request) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.query == nil {
+		return nil
+	}
+	variables := r.GetVariables()
+	needed := newSet()
+	for name := range variables {
+		needed.add(name)
+	}
+	for _, name := range r.query.untypedArgs(needed) {
+		if _, err := inferType(variables[name]); err != nil {
+			return fmt.Errorf("variable $%s has no type in gql_params: %w", name, err)
+		}
+	}
+	return nil
 }
 
 func (r *request) GetVariables() map[string]interface{} {
-	return r.argValues
+	if r.query == nil || len(r.query.variables) == 0 {
+		return r.argValues
+	}
+	variables := map[string]interface{}{}
+	for name, value := range r.query.variables {
+		variables[name] = value
+	}
+	for name, value := range r.argValues {
+		variables[name] = value
+	}
+	return variables
 }
 
-func (r *request) GetQuery() string {
-	for key := range r.argValues {
-		r.m.rootPart.markArgAsNeeded(key)
+func (r *request) GetOperationType() string {
+	return r.tp
+}
+
+func (r *request) GetOperationName() string {
+	if r.name != "" {
+		return r.name
+	}
+	if namer, ok := r.retVal.(GqlOperationNamer); ok {
+		return namer.GqlOperationName()
 	}
-	collectedArgs := r.m.rootPart.collectArgs()
-	builders := &strings.Builder{}
-	builders.WriteString(r.tp)
-	if len(collectedArgs) > 0 {
-		builders.WriteString("(")
-		builders.WriteString(strings.Join(collectedArgs, ", "))
-		builders.WriteString(")")
+	return ""
+}
+
+func (r *request) GetQuery() string {
+	if r.query == nil {
+		return ""
 	}
-	r.m.rootPart.buildStr(builders, 0)
-	return builders.String()
+	return r.query.render(r.tp, r.GetOperationName(), r.GetVariables())
 }
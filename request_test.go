@@ -1,6 +1,8 @@
 package graphql
 
 import (
+	"context"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -87,6 +89,42 @@ func TestSendCallsTransport(t *testing.T) {
 	assert.Equal(1, m.calledNum)
 }
 
+type mockContextTransport struct {
+	mockTransport2
+	ctx context.Context
+}
+
+func (m *mockContextTransport) TransportContext(ctx context.Context, req Request) (Response, error) {
+	m.ctx = ctx
+	return Response{}, nil
+}
+
+type ctxKey struct{}
+
+func TestSendContextUsesContextTransport(t *testing.T) {
+	assert := assert.New(t)
+	r := newReq()
+	m := &mockContextTransport{}
+	r.SetTransport(m)
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	r.SendContext(ctx)
+	assert.Equal(0, m.calledNum)
+	assert.Equal("value", m.ctx.Value(ctxKey{}))
+
+	r.Send()
+	assert.Equal(0, m.calledNum)
+	assert.NotNil(m.ctx)
+}
+
+func TestSendContextFallsBackToTransport(t *testing.T) {
+	assert := assert.New(t)
+	r := newReq()
+	m := &mockTransport2{}
+	r.SetTransport(m)
+	r.SendContext(context.Background())
+	assert.Equal(1, m.calledNum)
+}
+
 func TestCanAliasFields(t *testing.T) {
 	assert := assert.New(t)
 	req := newReq()
@@ -145,3 +183,120 @@ func TestJsonRequest(t *testing.T) {
 }
 `, reqStr)
 }
+
+func TestCanNameOperations(t *testing.T) {
+	assert := assert.New(t)
+	req := newReq()
+	req.Query(&struct {
+		Example struct {
+			Message string `json:"message"`
+		} `json:"example" gql_params:"name:Int"`
+	}{}).Named("GetExample").WithVariable("name", 1)
+	assert.Equal("GetExample", req.GetOperationName())
+	assert.Equal(`query GetExample($name:Int){
+    example(name:$name){
+        message
+    }
+}
+`, req.GetQuery())
+
+	req = newReq()
+	req.Mutation(&struct {
+		Example struct {
+			Message string `json:"message"`
+		} `json:"example"`
+	}{}).Named("DoExample")
+	assert.Equal(`mutation DoExample{
+    example{
+        message
+    }
+}
+`, req.GetQuery())
+}
+
+type namedQuery struct {
+	Message string `json:"message"`
+}
+
+func (n *namedQuery) GqlOperationName() string {
+	return "GetMessage"
+}
+
+func TestOperationNameFromType(t *testing.T) {
+	assert := assert.New(t)
+	req := newReq()
+	req.Query(&namedQuery{})
+	assert.Equal("GetMessage", req.GetOperationName())
+	assert.Equal("query GetMessage{\n    message\n}\n", req.GetQuery())
+	req.Named("Override")
+	assert.Equal("Override", req.GetOperationName())
+	assert.Equal("", newReq().Query(&testQuery{}).GetOperationName())
+}
+
+func TestGetQueryCanBeCalledManyTimes(t *testing.T) {
+	assert := assert.New(t)
+	req := newReq()
+	req.Query(&struct {
+		Example struct {
+			Message string `json:"message"`
+		} `json:"example" gql_params:"name:Int,id:ID,other:String"`
+	}{}).WithVariable("other", "x").WithVariable("name", 1).WithVariable("id", "1234")
+	first := req.GetQuery()
+	assert.Equal(first, req.GetQuery())
+	assert.Equal(`query($name:Int, $id:ID, $other:String){
+    example(name:$name, id:$id, other:$other){
+        message
+    }
+}
+`, first)
+}
+
+func TestFieldsCanUseDifferentVariablesForTheSameArgument(t *testing.T) {
+	assert := assert.New(t)
+	type named struct {
+		Name string `json:"name"`
+	}
+	query := newReq().Query(&struct {
+		User  named `json:"user" gql_params:"id:ID!=$userId"`
+		Org   named `json:"org" gql_params:"id:ID! = $orgId"`
+		Owner named `json:"owner" gql_params:"id=$userId"`
+		Other named `json:"other" gql_params:"id:ID!"`
+	}{}).WithVariable("userId", ID("1")).WithVariable("orgId", "2").GetQuery()
+	assert.Equal(`query($userId:ID!, $orgId:ID!){
+    user(id:$userId){
+        name
+    }
+    org(id:$orgId){
+        name
+    }
+    owner(id:$userId){
+        name
+    }
+    other{
+        name
+    }
+}
+`, query)
+}
+
+func TestSharedVariablesAreMarkedOnNestedFields(t *testing.T) {
+	assert := assert.New(t)
+	query := newReq().Query(&struct {
+		Hero struct {
+			Friends []struct {
+				Name string `json:"name"`
+			} `json:"friends" gql_params:"lang:String"`
+		} `json:"hero" gql_params:"lang:String"`
+	}{}).WithVariable("lang", "en").GetQuery()
+	assert.True(strings.HasPrefix(query, "query($lang:String){"), query)
+	assert.Contains(query, "hero(lang:$lang){")
+	assert.Contains(query, "friends(lang:$lang){")
+}
+
+func TestMalformedVariableName(t *testing.T) {
+	assert := assert.New(t)
+	_, err := Marshal(&struct {
+		User string `json:"user" gql_params:"id:ID!=userId"`
+	}{})
+	assert.EqualError(err, `User: the variable of argument id should be written as $name, got "userId"`)
+}
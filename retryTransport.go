@@ -0,0 +1,190 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryAttempts  = 3
+	defaultRetryBaseDelay = 100 * time.Millisecond
+	defaultRetryMaxDelay  = 5 * time.Second
+)
+
+// RetryOption configures a RetryTransport
+type RetryOption func(*RetryTransport)
+
+// RetryMaxAttempts sets how many times a request is sent at most, including the first attempt
+func RetryMaxAttempts(attempts int) RetryOption {
+	return func(r *RetryTransport) {
+		r.maxAttempts = attempts
+	}
+}
+
+// RetryBackoff sets the delay before the first retry and the most the delay can grow to. The delay doubles with
+// every attempt and a random jitter is taken off of it. Requests whose Retry-After is longer than maxDelay are not
+// retried.
+func RetryBackoff(baseDelay time.Duration, maxDelay time.Duration) RetryOption {
+	return func(r *RetryTransport) {
+		r.baseDelay = baseDelay
+		r.maxDelay = maxDelay
+	}
+}
+
+// RetryOnCodes makes the transport retry requests that fail with graphql errors whose extensions.code is one of codes
+func RetryOnCodes(codes ...string) RetryOption {
+	return func(r *RetryTransport) {
+		for _, code := range codes {
+			r.codes.add(code)
+		}
+	}
+}
+
+// RetryMutations allows mutations to be retried. Mutations are not retried by default because they might not be
+// safe to run twice.
+func RetryMutations() RetryOption {
+	return func(r *RetryTransport) {
+		r.retryMutations = true
+	}
+}
+
+// RetryTransport wraps a Transport and retries requests that fail with network errors, 5xx or 429 responses
+// or graphql errors with a code set with RetryOnCodes. It waits with exponential backoff and jitter between
+// attempts and honors the Retry-After header, giving up when it asks to wait longer than the max delay.
+// Mutations are only retried when RetryMutations is set. Requests with uploads are only retried when the readers
+// of their files can be sought back, see Upload.
+type RetryTransport struct {
+	next           Transport
+	maxAttempts    int
+	baseDelay      time.Duration
+	maxDelay       time.Duration
+	codes          *set
+	retryMutations bool
+}
+
+// NewRetryTransport wraps next with retries. It makes up to 3 attempts by default.
+func NewRetryTransport(next Transport, opts ...RetryOption) *RetryTransport {
+	transport := &RetryTransport{
+		next:        next,
+		maxAttempts: defaultRetryAttempts,
+		baseDelay:   defaultRetryBaseDelay,
+		maxDelay:    defaultRetryMaxDelay,
+		codes:       newSet(),
+	}
+	for _, opt := range opts {
+		opt(transport)
+	}
+	return transport
+}
+
+// Retry returns a middleware that wraps the transport of a client in a RetryTransport
+func Retry(opts ...RetryOption) Middleware {
+	return func(next Transport) Transport {
+		return NewRetryTransport(next, opts...)
+	}
+}
+
+// Transport sends the request, retrying it if it fails
+func (r *RetryTransport) Transport(req Request) (Response, error) {
+	return r.TransportContext(context.Background(), req)
+}
+
+// TransportContext sends the request, retrying it if it fails. It stops waiting for the next attempt when the
+// context is done.
+func (r *RetryTransport) TransportContext(ctx context.Context, req Request) (Response, error) {
+	attempts := r.maxAttempts
+	if req.GetOperationType() == "mutation" && !r.retryMutations {
+		attempts = 1
+	}
+	// the files of uploads are read by every attempt, a request is only retried if they can be read again
+	uploads := newUploadRewinder(req.GetVariables())
+	for attempt := 1; ; attempt++ {
+		resp, err := TransportWithContext(ctx, r.next, req)
+		if err == nil || attempt >= attempts || ctx.Err() != nil || !uploads.canRewind || !r.shouldRetry(resp, err) {
+			return resp, err
+		}
+		delay := r.backoff(attempt)
+		if retryAfter, ok := parseRetryAfter(resp.HttpResponse); ok {
+			// the server asked to wait longer than the transport is allowed to, an earlier attempt would fail too
+			if retryAfter > r.maxDelay {
+				return resp, err
+			}
+			delay = retryAfter
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, ctx.Err()
+		case <-timer.C:
+		}
+		if uploads.rewind() != nil {
+			return resp, err
+		}
+	}
+}
+
+// shouldRetry reports whether a failed attempt can be retried
+func (r *RetryTransport) shouldRetry(resp Response, err error) bool {
+	status := 0
+	statusErr := &StatusError{}
+	if errors.As(err, &statusErr) {
+		status = statusErr.StatusCode
+	} else if resp.HttpResponse != nil {
+		status = resp.HttpResponse.StatusCode
+	}
+	if status >= 500 || status == http.StatusTooManyRequests {
+		return true
+	}
+	errs := Errors{}
+	if errors.As(err, &errs) {
+		for _, gqlErr := range errs {
+			if r.codes.has(gqlErr.Code()) {
+				return true
+			}
+		}
+		return false
+	}
+	var netErr net.Error
+	return resp.HttpResponse == nil && errors.As(err, &netErr)
+}
+
+// backoff returns how long to wait after the given attempt
+func (r *RetryTransport) backoff(attempt int) time.Duration {
+	delay := r.baseDelay << uint(attempt-1)
+	if delay > r.maxDelay || delay <= 0 {
+		delay = r.maxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// parseRetryAfter reads the Retry-After header, given either in seconds or as an http date
+func parseRetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
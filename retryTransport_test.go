@@ -0,0 +1,198 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func flakyServer(failures int, status int, header http.Header, calls *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		*calls++
+		if *calls <= failures {
+			for key, values := range header {
+				rw.Header()[key] = values
+			}
+			rw.WriteHeader(status)
+			return
+		}
+		rw.Write([]byte(`{"data":{"message":"Good"}}`))
+	}))
+}
+
+func TestRetriesServerErrors(t *testing.T) {
+	for _, status := range []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusTooManyRequests} {
+		assert := assert.New(t)
+		calls := 0
+		server := flakyServer(2, status, nil, &calls)
+		transport := NewRetryTransport(NewSimpleHTTPTransport(server.URL), RetryBackoff(time.Millisecond, time.Millisecond))
+		msg := &testQuery{}
+		_, err := transport.Transport(newReq().Query(msg))
+		assert.NoError(err)
+		assert.Equal(3, calls)
+		assert.Equal("Good", msg.Message)
+		server.Close()
+	}
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	server := flakyServer(10, http.StatusServiceUnavailable, nil, &calls)
+	defer server.Close()
+	transport := NewRetryTransport(
+		NewSimpleHTTPTransport(server.URL),
+		RetryMaxAttempts(4),
+		RetryBackoff(time.Millisecond, time.Millisecond),
+	)
+	_, err := transport.Transport(newReq().Query(&testQuery{}))
+	statusErr := &StatusError{}
+	assert.True(errors.As(err, &statusErr))
+	assert.Equal(http.StatusServiceUnavailable, statusErr.StatusCode)
+	assert.Equal(4, calls)
+}
+
+func TestRetryDoesNotRetryClientErrors(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	server := flakyServer(1, http.StatusBadRequest, nil, &calls)
+	defer server.Close()
+	transport := NewRetryTransport(NewSimpleHTTPTransport(server.URL), RetryBackoff(time.Millisecond, time.Millisecond))
+	_, err := transport.Transport(newReq().Query(&testQuery{}))
+	assert.Error(err)
+	assert.Equal(1, calls)
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	server := flakyServer(1, http.StatusTooManyRequests, http.Header{"Retry-After": {"1"}}, &calls)
+	defer server.Close()
+	transport := NewRetryTransport(NewSimpleHTTPTransport(server.URL), RetryBackoff(time.Millisecond, time.Second))
+	start := time.Now()
+	_, err := transport.Transport(newReq().Query(&testQuery{}))
+	assert.NoError(err)
+	assert.Equal(2, calls)
+	assert.True(time.Since(start) >= time.Second)
+}
+
+func TestRetryGivesUpWhenRetryAfterExceedsMaxDelay(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	server := flakyServer(1, http.StatusTooManyRequests, http.Header{"Retry-After": {"3600"}}, &calls)
+	defer server.Close()
+	transport := NewRetryTransport(NewSimpleHTTPTransport(server.URL), RetryBackoff(time.Millisecond, time.Second))
+	start := time.Now()
+	_, err := transport.Transport(newReq().Query(&testQuery{}))
+	statusErr := &StatusError{}
+	assert.True(errors.As(err, &statusErr))
+	assert.Equal(http.StatusTooManyRequests, statusErr.StatusCode)
+	assert.Equal(1, calls)
+	assert.True(time.Since(start) < time.Second)
+}
+
+func TestRetryStopsWhenContextIsDone(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	server := flakyServer(10, http.StatusTooManyRequests, http.Header{"Retry-After": {"2"}}, &calls)
+	defer server.Close()
+	transport := NewRetryTransport(NewSimpleHTTPTransport(server.URL))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := transport.TransportContext(ctx, newReq().Query(&testQuery{}))
+	assert.Equal(context.DeadlineExceeded, err)
+	assert.Equal(1, calls)
+}
+
+func TestRetriesNetworkErrors(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}))
+	url := server.URL
+	server.Close()
+	calls := 0
+	counting := TransportFunc(func(ctx context.Context, req Request) (Response, error) {
+		calls++
+		return NewSimpleHTTPTransport(url).TransportContext(ctx, req)
+	})
+	transport := NewRetryTransport(counting, RetryBackoff(time.Millisecond, time.Millisecond))
+	_, err := transport.Transport(newReq().Query(&testQuery{}))
+	assert.Error(err)
+	assert.Equal(3, calls)
+}
+
+func TestRetriesGraphqlErrorCodes(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls == 1 {
+			rw.Write([]byte(`{"errors":[{"message":"try later","extensions":{"code":"SERVICE_UNAVAILABLE"}}]}`))
+			return
+		}
+		if calls == 2 {
+			rw.Write([]byte(`{"errors":[{"message":"bad","extensions":{"code":"BAD_USER_INPUT"}}]}`))
+			return
+		}
+		rw.Write([]byte(`{"data":{"message":"Good"}}`))
+	}))
+	defer server.Close()
+	transport := NewRetryTransport(
+		NewSimpleHTTPTransport(server.URL),
+		RetryOnCodes("SERVICE_UNAVAILABLE"),
+		RetryBackoff(time.Millisecond, time.Millisecond),
+	)
+	_, err := transport.Transport(newReq().Query(&testQuery{}))
+	assert.EqualError(err, "graphql: bad")
+	assert.Equal(2, calls)
+}
+
+func TestRetryDoesNotRetryMutations(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	server := flakyServer(2, http.StatusInternalServerError, nil, &calls)
+	defer server.Close()
+	c := NewClient(NewSimpleHTTPTransport(server.URL)).Use(Retry(RetryBackoff(time.Millisecond, time.Millisecond)))
+	_, err := c.NewRequest().Mutation(&testQuery{}).Send()
+	assert.Error(err)
+	assert.Equal(1, calls)
+
+	calls = 0
+	c = NewClient(NewSimpleHTTPTransport(server.URL)).Use(Retry(RetryBackoff(time.Millisecond, time.Millisecond), RetryMutations()))
+	_, err = c.NewRequest().Mutation(&testQuery{}).Send()
+	assert.NoError(err)
+	assert.Equal(3, calls)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	assert := assert.New(t)
+	transport := NewRetryTransport(nil, RetryBackoff(100*time.Millisecond, time.Second))
+	for i := 0; i < 20; i++ {
+		first := transport.backoff(1)
+		assert.True(first >= 50*time.Millisecond && first <= 100*time.Millisecond)
+		third := transport.backoff(3)
+		assert.True(third >= 200*time.Millisecond && third <= 400*time.Millisecond)
+		capped := transport.backoff(10)
+		assert.True(capped >= 500*time.Millisecond && capped <= time.Second)
+		assert.True(transport.backoff(100) <= time.Second)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert := assert.New(t)
+	_, ok := parseRetryAfter(nil)
+	assert.False(ok)
+	_, ok = parseRetryAfter(&http.Response{Header: http.Header{}})
+	assert.False(ok)
+	delay, ok := parseRetryAfter(&http.Response{Header: http.Header{"Retry-After": {"3"}}})
+	assert.True(ok)
+	assert.Equal(3*time.Second, delay)
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	delay, ok = parseRetryAfter(&http.Response{Header: http.Header{"Retry-After": {date}}})
+	assert.True(ok)
+	assert.True(delay > 59*time.Minute)
+}
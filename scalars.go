@@ -0,0 +1,69 @@
+package graphql
+
+import (
+	"encoding"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// GqlScalar marks a type as a custom scalar. The Marshaler selects fields of the type without a selection set and
+// they are decoded from whatever json the api sends for them.
+type GqlScalar interface {
+	GqlScalar()
+}
+
+var (
+	scalarType          = reflect.TypeOf(new(GqlScalar)).Elem()
+	textUnmarshalerType = reflect.TypeOf(new(encoding.TextUnmarshaler)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf(new(json.Unmarshaler)).Elem()
+)
+
+// scalars are the types registered with RegisterScalar for every Marshaler
+var scalars = sync.Map{}
+
+func init() {
+	RegisterScalar(time.Time{}, json.RawMessage{}, big.Int{}, big.Float{}, big.Rat{}, json.Number(""))
+}
+
+// RegisterScalar registers the go types of samples as scalars for every Marshaler. Types implementing GqlScalar,
+// encoding.TextUnmarshaler or json.Unmarshaler are scalars without being registered. time.Time, json.RawMessage,
+// json.Number and the math/big numbers are registered by default.
+func RegisterScalar(samples ...interface{}) {
+	for _, sample := range samples {
+		scalars.Store(scalarBase(reflect.TypeOf(sample)), true)
+	}
+	clearCompiledQueries()
+}
+
+// RegisterScalar registers the go types of samples as scalars for this Marshaler only
+func (g *Marshaler) RegisterScalar(samples ...interface{}) {
+	if g.scalars == nil {
+		g.scalars = map[reflect.Type]bool{}
+	}
+	for _, sample := range samples {
+		g.scalars[scalarBase(reflect.TypeOf(sample))] = true
+	}
+}
+
+// isScalar reports whether values of tp are selected as a scalar
+func (g *Marshaler) isScalar(tp reflect.Type) bool {
+	tp = scalarBase(tp)
+	if g.scalars[tp] {
+		return true
+	}
+	if _, ok := scalars.Load(tp); ok {
+		return true
+	}
+	ptr := reflect.PtrTo(tp)
+	return ptr.Implements(scalarType) || ptr.Implements(textUnmarshalerType) || ptr.Implements(jsonUnmarshalerType)
+}
+
+func scalarBase(tp reflect.Type) reflect.Type {
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+	return tp
+}
@@ -0,0 +1,97 @@
+package graphql
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type uuid [16]byte
+
+func (u *uuid) UnmarshalText(text []byte) error {
+	copy(u[:], text)
+	return nil
+}
+
+type money struct {
+	Cents    int
+	Currency string
+}
+
+func (money) GqlScalar() {}
+
+type point struct {
+	X, Y float64
+}
+
+type geoPoint struct {
+	Lat, Lng float64
+}
+
+type scalarQuery struct {
+	Order struct {
+		ID        uuid            `json:"id"`
+		CreatedAt time.Time       `json:"createdAt"`
+		ShippedAt *time.Time      `json:"shippedAt"`
+		Raw       json.RawMessage `json:"raw"`
+		Total     *big.Int        `json:"total"`
+		Ratio     big.Float       `json:"ratio"`
+		Price     money           `json:"price"`
+		Location  *point          `json:"location"`
+	} `json:"order"`
+}
+
+func TestMarshalsScalars(t *testing.T) {
+	realQ := `{
+    order{
+        id
+        createdAt
+        shippedAt
+        raw
+        total
+        ratio
+        price
+        location
+    }
+}
+`
+	assert := assert.New(t)
+	marshaler := NewMarshaler()
+	marshaler.RegisterScalar(&point{})
+	_, err := marshaler.MarshalToGraphql(&scalarQuery{})
+	assert.NoError(err)
+	assert.Equal(realQ, marshaler.String())
+
+	m, err := Marshal(&scalarQuery{})
+	assert.NoError(err)
+	assert.Contains(m.String(), "location{\n            X\n            Y\n        }")
+}
+
+func TestRegisterScalar(t *testing.T) {
+	assert := assert.New(t)
+	RegisterScalar(geoPoint{})
+	m, err := Marshal(&struct {
+		Where []*geoPoint `json:"where"`
+	}{})
+	assert.NoError(err)
+	assert.Equal("{\n    where\n}\n", m.String())
+}
+
+func TestDecodesScalars(t *testing.T) {
+	assert := assert.New(t)
+	query := &scalarQuery{}
+	_, err := unmarshalResponse([]byte(`{"data":{"order":{
+		"createdAt":"2020-01-02T03:04:05Z",
+		"raw":{"any":["json"]},
+		"total":123456789012345678901234567890,
+		"price":{"Cents":150,"Currency":"EUR"}
+	}}}`), query)
+	assert.NoError(err)
+	assert.Equal(2020, query.Order.CreatedAt.Year())
+	assert.JSONEq(`{"any":["json"]}`, string(query.Order.Raw))
+	assert.Equal("123456789012345678901234567890", query.Order.Total.String())
+	assert.Equal(money{Cents: 150, Currency: "EUR"}, query.Order.Price)
+}
@@ -0,0 +1,273 @@
+package graphql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultReconnectDelay = time.Second
+	defaultMaxReconnects  = 5
+)
+
+// sseEvent is a single event read off of a text/event-stream
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  []byte
+	Retry time.Duration
+}
+
+// sseReader reads events off of a text/event-stream
+type sseReader struct {
+	reader *bufio.Reader
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	return &sseReader{reader: bufio.NewReader(r)}
+}
+
+// next returns the next event of the stream. io.EOF is returned once the stream ends.
+func (s *sseReader) next() (sseEvent, error) {
+	event := sseEvent{}
+	data := [][]byte{}
+	hasField := false
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return event, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if !hasField {
+				continue
+			}
+			event.Data = bytes.Join(data, []byte("\n"))
+			return event, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		hasField = true
+		field, value := line, ""
+		if idx := strings.Index(line, ":"); idx >= 0 {
+			field = line[:idx]
+			value = strings.TrimPrefix(line[idx+1:], " ")
+		}
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			data = append(data, []byte(value))
+		case "id":
+			event.ID = value
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				event.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+// SSETransport sends requests following the GraphQL over Server-Sent Events protocol. The request is POSTed
+// the same way SimpleHTTPTransport does and the results are read off of the text/event-stream response.
+// When the stream drops before the server completes it, the transport reconnects and sends the id of the last
+// event it saw in the Last-Event-ID header.
+type SSETransport struct {
+	apiURL         string
+	headers        map[string][]string
+	reconnectDelay time.Duration
+	maxReconnects  int
+	client         *http.Client
+}
+
+// SSEOption configures a SSETransport. Options are applied in the order they are passed in.
+type SSEOption func(*SSETransport)
+
+// WithSSEHTTPClient sets the http client the transport opens streams with, e.g. to configure TLS or a proxy. The
+// Timeout of the client also limits how long a stream stays open, use the context of the request to limit
+// subscriptions instead. A nil client is replaced by a new default client.
+func WithSSEHTTPClient(client *http.Client) SSEOption {
+	return func(s *SSETransport) {
+		if client == nil {
+			client = &http.Client{}
+		}
+		s.client = client
+	}
+}
+
+// NewSSETransport takes the api URL and then returns a SSETransport
+func NewSSETransport(apiURL string, opts ...SSEOption) *SSETransport {
+	transport := &SSETransport{
+		apiURL:         apiURL,
+		headers:        map[string][]string{},
+		reconnectDelay: defaultReconnectDelay,
+		maxReconnects:  defaultMaxReconnects,
+		client:         &http.Client{},
+	}
+	transport.AddHeader("Content-Type", "application/json")
+	transport.AddHeader("Accept", "text/event-stream")
+	for _, opt := range opts {
+		opt(transport)
+	}
+	return transport
+}
+
+// AddHeader adds a header onto the request object
+func (s *SSETransport) AddHeader(name string, value string) {
+	s.headers[name] = append(s.headers[name], value)
+}
+
+// SetReconnect sets how long to wait before reconnecting a dropped stream and how many times in a row to try.
+// The server can change the delay by sending a retry field.
+func (s *SSETransport) SetReconnect(delay time.Duration, maxAttempts int) {
+	s.reconnectDelay = delay
+	s.maxReconnects = maxAttempts
+}
+
+// Transport sends the request and returns the first result of the stream
+func (s *SSETransport) Transport(req Request) (Response, error) {
+	return s.TransportContext(context.Background(), req)
+}
+
+// TransportContext sends the request and returns the first result of the stream. The result is decoded into
+// the object the request was built with.
+func (s *SSETransport) TransportContext(ctx context.Context, req Request) (Response, error) {
+	var response Response
+	var respErr error
+	received := false
+	err := s.subscribe(ctx, req, req.GetInterface, func(resp Response, err error) error {
+		response, respErr, received = resp, err, true
+		return errStopSubscription
+	})
+	if err != nil && err != errStopSubscription {
+		return response, err
+	}
+	if !received {
+		return response, errors.New("graphql: operation completed without a result")
+	}
+	return response, respErr
+}
+
+// Subscribe sends the request and calls handler with every result until the server completes the stream
+func (s *SSETransport) Subscribe(ctx context.Context, req Request, handler SubscriptionHandler) error {
+	return s.subscribe(ctx, req, func() interface{} { return newResponseObject(req) }, handler)
+}
+
+// sseStreamError is an error reading the stream that can be recovered from by reconnecting
+type sseStreamError struct {
+	err error
+}
+
+func (s sseStreamError) Error() string {
+	return s.err.Error()
+}
+
+func (s *SSETransport) subscribe(ctx context.Context, req Request, newObj func() interface{}, handler SubscriptionHandler) error {
+	bts, err := json.Marshal(newGraphqlRequest(req))
+	if err != nil {
+		return err
+	}
+	stream := &sseStream{
+		transport: s,
+		body:      bts,
+		delay:     s.reconnectDelay,
+	}
+	attempts := 0
+	for {
+		received, err := stream.read(ctx, newObj, handler)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		streamErr, ok := err.(sseStreamError)
+		if !ok {
+			return err
+		}
+		if received {
+			attempts = 0
+		}
+		attempts++
+		if attempts > s.maxReconnects {
+			return streamErr.err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(stream.delay):
+		}
+	}
+}
+
+// sseStream keeps the state of a stream across reconnects
+type sseStream struct {
+	transport   *SSETransport
+	body        []byte
+	lastEventID string
+	delay       time.Duration
+}
+
+// read opens the stream and hands every result to the handler. It returns nil once the server completes the
+// stream and a sseStreamError when the stream dropped. received reports if any event was read.
+func (s *sseStream) read(ctx context.Context, newObj func() interface{}, handler SubscriptionHandler) (bool, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", s.transport.apiURL, bytes.NewBuffer(s.body))
+	if err != nil {
+		return false, err
+	}
+	addHeaders(httpReq, s.transport.headers)
+	if s.lastEventID != "" {
+		httpReq.Header.Set("Last-Event-ID", s.lastEventID)
+	}
+	resp, err := s.transport.client.Do(httpReq)
+	if err != nil {
+		return false, sseStreamError{err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	reader := newSSEReader(resp.Body)
+	received := false
+	for {
+		event, err := reader.next()
+		if err == io.EOF {
+			return received, sseStreamError{errors.New("graphql: event stream ended before it was completed")}
+		}
+		if err != nil {
+			return received, sseStreamError{err}
+		}
+		received = true
+		if event.ID != "" {
+			s.lastEventID = event.ID
+		}
+		if event.Retry > 0 {
+			s.delay = event.Retry
+		}
+		switch event.Event {
+		case "next", "":
+			if len(event.Data) == 0 {
+				continue
+			}
+			response := Response{
+				HttpRequest:  httpReq,
+				HttpResponse: resp,
+			}
+			opErr := response.decode(event.Data, newObj())
+			if err := handler(response, opErr); err != nil {
+				return received, err
+			}
+		case "complete":
+			return received, nil
+		}
+	}
+}
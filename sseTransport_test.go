@@ -0,0 +1,212 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSEReaderParsesEvents(t *testing.T) {
+	assert := assert.New(t)
+	reader := newSSEReader(strings.NewReader(": comment\r\n" +
+		"event: next\r\nid: 1\r\ndata: {\"a\":\r\ndata: 1}\r\n\r\n" +
+		"retry: 250\n\n" +
+		"event: complete\ndata\n\n"))
+	event, err := reader.next()
+	assert.NoError(err)
+	assert.Equal("next", event.Event)
+	assert.Equal("1", event.ID)
+	assert.Equal("{\"a\":\n1}", string(event.Data))
+
+	event, err = reader.next()
+	assert.NoError(err)
+	assert.Equal(250*time.Millisecond, event.Retry)
+
+	event, err = reader.next()
+	assert.NoError(err)
+	assert.Equal("complete", event.Event)
+	assert.Empty(event.Data)
+
+	_, err = reader.next()
+	assert.Error(err)
+}
+
+func writeSSE(rw http.ResponseWriter, id string, event string, data string) {
+	if id != "" {
+		fmt.Fprintf(rw, "id: %s\n", id)
+	}
+	fmt.Fprintf(rw, "event: %s\ndata: %s\n\n", event, data)
+	rw.(http.Flusher).Flush()
+}
+
+func TestSSESubscription(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal("text/event-stream", req.Header.Get("Accept"))
+		body := graphqlRequest{}
+		assert.NoError(json.NewDecoder(req.Body).Decode(&body))
+		assert.Equal("general", body.Variables["room"])
+		assert.Contains(body.Query, "subscription($room:String)")
+		rw.Header().Set("Content-Type", "text/event-stream")
+		writeSSE(rw, "", "next", `{"data":{"messageAdded":{"text":"one"}}}`)
+		writeSSE(rw, "", "next", `{"data":{"messageAdded":{"text":"two"}}}`)
+		writeSSE(rw, "", "complete", "")
+	}))
+	defer server.Close()
+
+	sub := &testSubscription{}
+	req := NewClient(NewSSETransport(server.URL)).NewRequest().Subscription(sub).WithVariable("room", "general")
+	received := []*testSubscription{}
+	err := req.Subscribe(context.Background(), func(resp Response, err error) error {
+		assert.NoError(err)
+		received = append(received, resp.Response.(*testSubscription))
+		return nil
+	})
+	assert.NoError(err)
+	assert.Len(received, 2)
+	assert.Equal("one", received[0].MessageAdded.Text)
+	assert.Equal("two", received[1].MessageAdded.Text)
+	assert.True(received[0] != sub)
+}
+
+func TestSSEReconnectsWithLastEventID(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	lastIDs := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls++
+		lastIDs = append(lastIDs, req.Header.Get("Last-Event-ID"))
+		rw.Header().Set("Content-Type", "text/event-stream")
+		if calls == 1 {
+			fmt.Fprint(rw, "retry: 10\n\n")
+			writeSSE(rw, "1", "next", `{"data":{"messageAdded":{"text":"one"}}}`)
+			return
+		}
+		writeSSE(rw, "2", "next", `{"data":{"messageAdded":{"text":"two"}}}`)
+		writeSSE(rw, "", "complete", "")
+	}))
+	defer server.Close()
+
+	transport := NewSSETransport(server.URL)
+	transport.SetReconnect(time.Minute, 1)
+	req := newReq().Subscription(&testSubscription{}).SetTransport(transport)
+	texts := []string{}
+	err := req.Subscribe(context.Background(), func(resp Response, err error) error {
+		texts = append(texts, resp.Response.(*testSubscription).MessageAdded.Text)
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal(2, calls)
+	assert.Equal([]string{"", "1"}, lastIDs)
+	assert.Equal([]string{"one", "two"}, texts)
+}
+
+func TestSSEGivesUpAfterMaxReconnects(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls++
+		rw.Header().Set("Content-Type", "text/event-stream")
+	}))
+	defer server.Close()
+
+	transport := NewSSETransport(server.URL)
+	transport.SetReconnect(time.Millisecond, 2)
+	req := newReq().Subscription(&testSubscription{}).SetTransport(transport)
+	err := req.Subscribe(context.Background(), func(resp Response, err error) error { return nil })
+	assert.Error(err)
+	assert.Equal(3, calls)
+}
+
+func TestSSESubscriptionCancel(t *testing.T) {
+	assert := assert.New(t)
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "text/event-stream")
+		writeSSE(rw, "", "next", `{"data":{"messageAdded":{"text":"one"}}}`)
+		select {
+		case <-req.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	req := newReq().Subscription(&testSubscription{}).SetTransport(NewSSETransport(server.URL))
+	ctx, cancel := context.WithCancel(context.Background())
+	err := req.Subscribe(ctx, func(resp Response, err error) error {
+		cancel()
+		return nil
+	})
+	assert.Equal(context.Canceled, err)
+}
+
+func TestSSETransportReturnsFirstResult(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "text/event-stream")
+		writeSSE(rw, "", "next", `{"data":{"message":"Good","sub_query":{"message":"Great"}}}`)
+		writeSSE(rw, "", "complete", "")
+	}))
+	defer server.Close()
+
+	msg := &testQuery{}
+	resp, err := NewClient(NewSSETransport(server.URL)).NewRequest().Query(msg).Send()
+	assert.NoError(err)
+	assert.Equal("Good", msg.Message)
+	assert.Equal("Great", msg.SubQ.SubMessage)
+	assert.Equal(msg, resp.Response)
+}
+
+func TestSSEUsesItsHTTPClient(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "text/event-stream")
+		writeSSE(rw, "", "next", `{"data":{"message":"Good"}}`)
+		writeSSE(rw, "", "complete", "")
+	}))
+	defer server.Close()
+
+	roundTripper := &countingRoundTripper{}
+	transport := NewSSETransport(server.URL, WithSSEHTTPClient(&http.Client{Transport: roundTripper}))
+	_, err := NewClient(transport).NewRequest().Query(&testQuery{}).Send()
+	assert.NoError(err)
+	assert.Equal(1, roundTripper.calls)
+}
+
+func TestSSEReturnsStatusErrors(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.Header().Set("Content-Type", "text/event-stream")
+		writeSSE(rw, "", "next", `{"data":{"message":"Good"}}`)
+		writeSSE(rw, "", "complete", "")
+	}))
+	defer server.Close()
+
+	_, err := NewSSETransport(server.URL).Transport(newReq().Query(&testQuery{}))
+	statusErr := &StatusError{}
+	assert.True(errors.As(err, &statusErr))
+	assert.Equal(http.StatusServiceUnavailable, statusErr.StatusCode)
+
+	calls = 0
+	msg := &testQuery{}
+	transport := NewRetryTransport(NewSSETransport(server.URL), RetryBackoff(time.Millisecond, time.Millisecond))
+	_, err = transport.Transport(newReq().Query(msg))
+	assert.NoError(err)
+	assert.Equal(2, calls)
+	assert.Equal("Good", msg.Message)
+}
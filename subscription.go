@@ -0,0 +1,34 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"reflect"
+)
+
+// ErrSubscriptionsNotSupported is returned when a subscription is started on a request whose transport
+// does not implement SubscriptionTransport
+var ErrSubscriptionsNotSupported = errors.New("graphql: transport does not support subscriptions")
+
+// SubscriptionHandler is called for every result a subscription receives. Response.Response holds a freshly
+// decoded copy of the struct passed to Subscription. err is set when the server sends an error for the
+// subscription. Returning an error from the handler stops the subscription and Subscribe returns that error.
+type SubscriptionHandler func(resp Response, err error) error
+
+// SubscriptionTransport is a Transport that can stream many results for a single request
+type SubscriptionTransport interface {
+	// Subscribe starts the subscription and calls handler for every result. It blocks until the server
+	// completes the subscription, the context is done or the handler returns an error.
+	Subscribe(ctx context.Context, req Request, handler SubscriptionHandler) error
+}
+
+// newResponseObject returns a new zeroed copy of the object the request was built from so that every result
+// of a subscription gets its own value
+func newResponseObject(req Request) interface{} {
+	obj := req.GetInterface()
+	tp := reflect.TypeOf(obj)
+	if tp == nil || tp.Kind() != reflect.Ptr {
+		return obj
+	}
+	return reflect.New(tp.Elem()).Interface()
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -13,6 +14,20 @@ type Marshaler struct {
 	rootPart      *QueryPart
 	includedArgs  map[string]bool
 	IdentLevel    int
+	// fragments are the named fragment definitions in the order they were first used
+	fragments []*QueryPart
+	// fragmentNames maps the fragment types to the name they are defined with in the document
+	fragmentNames map[reflect.Type]string
+	// variables are the values of variables the marshaled object brings with it, like the ones of Aliased
+	variables map[string]interface{}
+	// scalars are the types registered as scalars for this Marshaler
+	scalars map[reflect.Type]bool
+	// MaxDepth is how many levels deep a recursive struct type is unrolled, a field that would nest it deeper is
+	// left out of the query, and so is a field left with nothing to select. A field can set its own limit with
+	// gql:"depth=N". When neither is set, marshaling a recursive type fails.
+	MaxDepth int
+	// visiting are the struct types being marshaled, from the root to the current one
+	visiting []reflect.Type
 }
 
 // GqlMarshaler implements a way to Marshal to a graphql request. This returns a list of QueryParts
@@ -21,6 +36,21 @@ type GqlMarshaler interface {
 	MarshalGql(marshaler *Marshaler) ([]*QueryPart, error)
 }
 
+// GqlFragment marks a struct type as a named fragment. Instead of selecting its fields at every place the type is
+// used, the Marshaler spreads the fragment with ...Name and defines it once at the end of the document as
+// fragment Name on Type. The name is the name of the go type, GqlFragmentOn returns the type condition.
+type GqlFragment interface {
+	GqlFragmentOn() string
+}
+
+var marshalerType = reflect.TypeOf(new(GqlMarshaler)).Elem()
+
+var fragmentType = reflect.TypeOf(new(GqlFragment)).Elem()
+
+// errNothingSelected is returned for a struct whose fields were all left out by depth limits. The field holding
+// it is left out as well, since a selection set can't be empty.
+var errNothingSelected = errors.New("every field was left out by the depth limit, the selection would be empty")
+
 // NewMarshaler returns a new Marshaler
 func NewMarshaler() *Marshaler {
 	return &Marshaler{
@@ -28,11 +58,68 @@ func NewMarshaler() *Marshaler {
 		rootPart:      nil,
 		includedArgs:  map[string]bool{},
 		IdentLevel:    0,
+		fragmentNames: map[reflect.Type]string{},
+	}
+}
+
+// isFragment reports whether the struct type is a named fragment. A struct that embeds a fragment gets its
+// GqlFragmentOn method promoted, it is not a fragment itself and the embedded fragment is spread in it instead.
+func isFragment(tp reflect.Type) bool {
+	if tp.Kind() != reflect.Struct || tp.Name() == "" || !reflect.PtrTo(tp).Implements(fragmentType) {
+		return false
+	}
+	for i := 0; i < tp.NumField(); i++ {
+		field := tp.Field(i)
+		if field.Anonymous && reflect.PtrTo(field.Type).Implements(fragmentType) {
+			return false
+		}
+	}
+	return true
+}
+
+// spreadFragment adds a spread of the fragment type to parent, defining the fragment the first time it is used
+func (g *Marshaler) spreadFragment(tp reflect.Type, parent *QueryPart) error {
+	name, defined := g.fragmentNames[tp]
+	if !defined {
+		name = g.fragmentName(tp)
+		g.fragmentNames[tp] = name
+		onType := reflect.New(tp).Interface().(GqlFragment).GqlFragmentOn()
+		def := NewQueryPart(fmt.Sprintf("fragment %s on %s", name, onType))
+		g.fragments = append(g.fragments, def)
+		if err := g.marshalStruct(tp, reflect.New(tp).Elem(), def); err != nil {
+			if errors.Is(err, errNothingSelected) {
+				g.fragments = g.fragments[:len(g.fragments)-1]
+				delete(g.fragmentNames, tp)
+			}
+			return err
+		}
+	}
+	parent.SubFields = append(parent.SubFields, NewQueryPart("..."+name))
+	return nil
+}
+
+// fragmentName returns a name for the fragment that no other fragment in the document uses
+func (g *Marshaler) fragmentName(tp reflect.Type) string {
+	taken := newSet()
+	for _, name := range g.fragmentNames {
+		taken.add(name)
+	}
+	name := tp.Name()
+	for i := 2; taken.has(name); i++ {
+		name = fmt.Sprintf("%s%d", tp.Name(), i)
 	}
+	return name
 }
 
 func (g *Marshaler) marshalStruct(tp reflect.Type, val reflect.Value, rootPart *QueryPart) error {
+	g.visiting = append(g.visiting, tp)
+	defer func() {
+		g.visiting = g.visiting[:len(g.visiting)-1]
+	}()
 	numFields := tp.NumField()
+	hasFragments := false
+	selected := len(rootPart.SubFields)
+	leftOut := false
 	for i := 0; i < numFields; i++ {
 		field := tp.Field(i)
 		gqlTags, hasGqlTags := field.Tag.Lookup("gql")
@@ -41,11 +128,38 @@ func (g *Marshaler) marshalStruct(tp reflect.Type, val reflect.Value, rootPart *
 			tags = newSet(strings.Split(gqlTags, ",")...)
 		}
 		gqlParams, hasParams := field.Tag.Lookup("gql_params")
-		params := newSet(strings.Split(gqlParams, ",")...)
+		gqlDirectives, hasDirectives := field.Tag.Lookup("gql_directives")
+		gqlArgs, hasArgs := field.Tag.Lookup("gql_args")
 		json, hasJson := field.Tag.Lookup("json")
 		values := strings.Split(gqlTags, ",")
 		jsonValues := strings.Split(json, ",")
-		if tags.has("omit") {
+		// like encoding/json, only embedded structs are read from unexported fields
+		if tags.has("omit") || (field.PkgPath != "" && !(field.Anonymous && isStruct(field.Type))) {
+			continue
+		}
+		fieldVal := val.Field(i)
+		if field.PkgPath != "" {
+			fieldVal = reflect.New(field.Type).Elem()
+		}
+		alias := values[0]
+		if strings.HasPrefix(alias, "depth=") {
+			alias = ""
+		}
+		hasAlias := hasGqlTags && alias != ""
+		tooDeep, err := g.tooDeep(field.Type, tags)
+		if err != nil {
+			return wrapField(field.Name, err)
+		}
+		if tooDeep {
+			leftOut = true
+			continue
+		}
+		if field.Anonymous && jsonValues[0] == "" && !hasAlias && isStruct(field.Type) {
+			if err := g.marshal(field.Type, fieldVal, rootPart); errors.Is(err, errNothingSelected) {
+				leftOut = true
+			} else if err != nil {
+				return err
+			}
 			continue
 		}
 		var name string
@@ -54,36 +168,93 @@ func (g *Marshaler) marshalStruct(tp reflect.Type, val reflect.Value, rootPart *
 		} else {
 			name = jsonValues[0]
 		}
-		if hasJson && hasGqlTags {
-			name = fmt.Sprintf("%s: %s", jsonValues[0], values[0])
+		if hasJson && hasAlias {
+			name = fmt.Sprintf("%s: %s", jsonValues[0], alias)
+		}
+		if onType, isFragment := parseInlineFragment(values[0]); hasGqlTags && isFragment {
+			name = inlineFragmentPrefix + onType
+			hasFragments = true
+		} else if jsonValues[0] == "-" && len(jsonValues) == 1 {
+			continue
 		}
 		part := NewQueryPart(name)
 		if hasParams {
-			for _, param := range params.elements() {
-				parts := strings.Split(strings.Trim(param, " "), ":")
-				name := parts[0]
-				tps := parts[1]
-				part.Arguments[name] = tps
+			for _, param := range strings.Split(gqlParams, ",") {
+				param, variable := splitVariable(param)
+				parts := strings.SplitN(strings.Trim(param, " "), ":", 2)
+				name := strings.TrimSpace(parts[0])
+				if name == "" {
+					return wrapField(field.Name, fmt.Errorf("gql_params entry %q has no argument name", param))
+				}
+				tps := ""
+				if len(parts) == 2 {
+					tps = strings.TrimSpace(parts[1])
+				}
+				if variable == "" {
+					part.addArgument(name, tps)
+					continue
+				}
+				if !strings.HasPrefix(variable, "$") || len(variable) == 1 {
+					return wrapField(field.Name, fmt.Errorf("the variable of argument %s should be written as $name, got %q", name, variable))
+				}
+				part.addVariableArgument(name, tps, variable[1:])
 			}
 		}
+		if hasArgs {
+			literalArgs, err := parseLiteralArgs(gqlArgs)
+			if err != nil {
+				return wrapField(field.Name, err)
+			}
+			part.literalArgs = literalArgs
+		}
+		if hasDirectives {
+			directives, err := parseDirectives(gqlDirectives)
+			if err != nil {
+				return wrapField(field.Name, err)
+			}
+			part.directives = directives
+		}
 
-		g.marshal(tp.Field(i).Type, val.Field(i), part)
+		if err := g.marshal(field.Type, fieldVal, part); errors.Is(err, errNothingSelected) {
+			leftOut = true
+			continue
+		} else if err != nil {
+			return wrapField(field.Name, err)
+		}
 		rootPart.SubFields = append(rootPart.SubFields, part)
 	}
+	if leftOut && len(rootPart.SubFields) == selected {
+		return errNothingSelected
+	}
+	if hasFragments && !rootPart.hasField(typenameField) {
+		rootPart.SubFields = append([]*QueryPart{NewQueryPart(typenameField)}, rootPart.SubFields...)
+	}
 	return nil
 }
 
+// splitVariable splits a gql_params entry like id:ID!=$userId into the argument and the variable it takes its value
+// from
+func splitVariable(param string) (string, string) {
+	parts := strings.SplitN(param, "=", 2)
+	if len(parts) == 1 {
+		return param, ""
+	}
+	return parts[0], strings.TrimSpace(parts[1])
+}
+
 func (g *Marshaler) marshal(tp reflect.Type, val reflect.Value, parent *QueryPart) error {
-	mType := reflect.TypeOf(new(GqlMarshaler)).Elem()
-	if tp.Implements(mType) {
+	if tp.Implements(marshalerType) {
 		m := val.Interface().(GqlMarshaler)
 		queryParties, err := m.MarshalGql(g)
 		if err != nil {
-			return nil
+			return err
 		}
 		parent.SubFields = append(parent.SubFields, queryParties...)
 		return nil
 	}
+	if g.isScalar(tp) {
+		return nil
+	}
 	switch kind := tp.Kind(); kind {
 	case reflect.Ptr:
 		if val.IsNil() {
@@ -91,44 +262,150 @@ func (g *Marshaler) marshal(tp reflect.Type, val reflect.Value, parent *QueryPar
 		}
 		return g.marshal(tp.Elem(), val.Elem(), parent)
 	case reflect.Struct:
+		// a fragment can't spread itself, inside of its own definition it is selected inline, so recursive
+		// fragments are unrolled up to their depth limit like other struct types
+		if isFragment(tp) && !g.isVisiting(tp) {
+			return g.spreadFragment(tp, parent)
+		}
 		return g.marshalStruct(tp, val, parent)
-	case reflect.String:
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return nil
+	case reflect.Map, reflect.Interface:
+		// maps and interfaces are decoded from whatever json the field holds, they are selected as scalars
+		return nil
+	case reflect.Slice, reflect.Array:
+		if tp.Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		if err := g.marshal(tp.Elem(), reflect.New(tp.Elem()).Elem(), parent); err != nil {
+			return wrapElem(err)
+		}
 		return nil
-	case reflect.Slice:
-		return g.marshal(tp.Elem(), reflect.New(tp.Elem()).Elem(), parent)
 	default:
-		return fmt.Errorf("unrecognized kind: %s. this isn't supposed to happen, let us know if it does", kind)
+		return fmt.Errorf("unsupported kind %s, it can't be decoded from json", kind)
 	}
 }
 
+// isVisiting reports whether a struct of type tp is being marshaled, i.e. whether tp is selected inside of itself
+func (g *Marshaler) isVisiting(tp reflect.Type) bool {
+	for _, visiting := range g.visiting {
+		if visiting == tp {
+			return true
+		}
+	}
+	return false
+}
+
+// tooDeep reports whether a field of type tp would nest a recursive struct type deeper than its depth limit. It
+// fails when the type is recursive and has no limit.
+func (g *Marshaler) tooDeep(tp reflect.Type, tags *set) (bool, error) {
+	limit := g.MaxDepth
+	for _, tag := range tags.elements() {
+		if !strings.HasPrefix(tag, "depth=") {
+			continue
+		}
+		fieldLimit, err := strconv.Atoi(strings.TrimPrefix(tag, "depth="))
+		if err != nil || fieldLimit < 1 {
+			return false, fmt.Errorf("%q should set the depth to a positive number", tag)
+		}
+		limit = fieldLimit
+	}
+	for tp.Kind() == reflect.Ptr || tp.Kind() == reflect.Slice || tp.Kind() == reflect.Array {
+		tp = tp.Elem()
+	}
+	if tp.Kind() != reflect.Struct || g.isScalar(tp) || reflect.PtrTo(tp).Implements(marshalerType) {
+		return false, nil
+	}
+	depth := 0
+	for _, visiting := range g.visiting {
+		if visiting == tp {
+			depth++
+		}
+	}
+	if depth == 0 {
+		return false, nil
+	}
+	if limit <= 0 {
+		return false, fmt.Errorf("%s is recursive, limit how deep it is unrolled with gql:\"depth=N\" or Marshaler.MaxDepth", tp)
+	}
+	return depth >= limit, nil
+}
+
+// isStruct reports whether tp is a struct or a pointer to one
+func isStruct(tp reflect.Type) bool {
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+	return tp.Kind() == reflect.Struct
+}
+
 // MarshalToGraphql takes the object and returns a new graphql query
 func (g *Marshaler) MarshalToGraphql(obj interface{}, argsToInclude ...string) (string, error) {
 	tp := reflect.TypeOf(obj)
 	val := reflect.ValueOf(obj)
 	g.rootPart = NewQueryPart("")
-	if tp.Kind() != reflect.Ptr {
+	g.fragments = nil
+	g.fragmentNames = map[reflect.Type]string{}
+	g.variables = nil
+	g.visiting = nil
+	if tp == nil || tp.Kind() != reflect.Ptr {
 		return "", errors.New("object should be a pointer")
 	}
 	err := g.marshal(tp, val, g.rootPart)
-	for _, arg := range argsToInclude {
-		g.rootPart.markArgAsNeeded(arg)
-	}
+	g.AddToArgs(argsToInclude...)
 	return g.joinParts(), err
 }
 
 func (g *Marshaler) joinParts() string {
-	return g.rootPart.String()
+	builder := &strings.Builder{}
+	g.buildStr(builder)
+	return builder.String()
+}
+
+// buildStr writes the selection set followed by the fragment definitions
+func (g *Marshaler) buildStr(builder *strings.Builder) {
+	g.rootPart.buildStr(builder, 0)
+	for _, fragment := range g.fragments {
+		fragment.buildStr(builder, 0)
+	}
 }
 
 // String converts the current state of the Marshaler to a string
 func (g *Marshaler) String() string {
-	return g.rootPart.String()
+	return g.joinParts()
+}
+
+// AddVariable sets the value of a variable the marshaled object uses. It is sent with the variables of the request,
+// a variable set on the request with WithVariable takes precedence.
+func (g *Marshaler) AddVariable(name string, value interface{}) {
+	if g.variables == nil {
+		g.variables = map[string]interface{}{}
+	}
+	g.variables[name] = value
+}
+
+// UniqueVariable returns name, or name with a number after it when a variable with that name was already added
+// with AddVariable. Marshalers use it to name the variables they add without clashing with each other.
+func (g *Marshaler) UniqueVariable(name string) string {
+	unique := name
+	for i := 2; ; i++ {
+		if _, taken := g.variables[unique]; !taken {
+			return unique
+		}
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
 }
 
 // AddToArgs adds a new arg name to be added as part of the query
 func (g *Marshaler) AddToArgs(argNames ...string) {
 	for _, argName := range argNames {
 		g.rootPart.markArgAsNeeded(argName)
+		for _, fragment := range g.fragments {
+			fragment.markArgAsNeeded(argName)
+		}
 	}
 }
 
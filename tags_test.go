@@ -207,3 +207,212 @@ func TestCanConvertMarshalerSlice(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal(noSpaces(realQ), noSpaces(q))
 }
+
+type embeddedBase struct {
+	ID string `json:"id"`
+}
+
+type embeddedExtra struct {
+	Created int `json:"created"`
+}
+
+type embeddedString string
+
+func TestMarshalsAllLeafKinds(t *testing.T) {
+	realQ := `{
+    example{
+        b
+        i
+        i8
+        u64
+        f
+        ints
+        grid
+        bytes
+        meta
+        any
+        anyList
+    }
+}
+`
+	assert := assert.New(t)
+	m, err := Marshal(&struct {
+		Example struct {
+			B       bool                   `json:"b"`
+			I       int                    `json:"i"`
+			I8      *int8                  `json:"i8"`
+			U64     uint64                 `json:"u64"`
+			F       float64                `json:"f"`
+			Ints    []int                  `json:"ints"`
+			Grid    [3][3]float32          `json:"grid"`
+			Bytes   []byte                 `json:"bytes"`
+			Meta    map[string]interface{} `json:"meta"`
+			Any     interface{}            `json:"any"`
+			AnyList []interface{}          `json:"anyList"`
+		} `json:"example"`
+	}{})
+	assert.NoError(err)
+	assert.Equal(realQ, m.String())
+}
+
+func TestFlattensEmbeddedStructs(t *testing.T) {
+	realQ := `{
+    user{
+        id
+        created
+        name
+        base{
+            id
+        }
+    }
+}
+`
+	assert := assert.New(t)
+	m, err := Marshal(&struct {
+		User struct {
+			embeddedBase
+			*embeddedExtra
+			embeddedString
+			Name    string       `json:"name"`
+			Base    embeddedBase `json:"base"`
+			hidden  string
+			Skipped string `json:"-"`
+		} `json:"user"`
+	}{})
+	assert.NoError(err)
+	assert.Equal(realQ, m.String())
+}
+
+func TestEmbeddedStructWithJsonNameIsAField(t *testing.T) {
+	assert := assert.New(t)
+	m, err := Marshal(&struct {
+		embeddedBase `json:"base"`
+	}{})
+	assert.NoError(err)
+	assert.Equal("{\n    base{\n        id\n    }\n}\n", m.String())
+}
+
+func TestUnsupportedKinds(t *testing.T) {
+	assert := assert.New(t)
+	_, err := Marshal(&struct {
+		Events chan string `json:"events"`
+	}{})
+	assert.EqualError(err, "Events: unsupported kind chan, it can't be decoded from json")
+	_, err = Marshal(&struct {
+		Callback func() `json:"callback"`
+	}{})
+	assert.Error(err)
+	_, err = Marshal(&struct {
+		Nested struct {
+			Value complex128 `json:"value"`
+		} `json:"nested"`
+	}{})
+	assert.Error(err)
+}
+
+type treeNode struct {
+	Name     string      `json:"name"`
+	Children []*treeNode `json:"children"`
+}
+
+type limitedNode struct {
+	Name     string         `json:"name"`
+	Parent   *limitedNode   `json:"parent" gql:"depth=2"`
+	Children []*limitedNode `json:"children" gql:"depth=3"`
+}
+
+// childrenOnly has nothing to select once its depth limit is reached
+type childrenOnly struct {
+	Children []childrenOnly `json:"children" gql:"depth=2"`
+}
+
+func TestDepthLimitLeavesOutEmptySelections(t *testing.T) {
+	realQ := `{
+    count
+    node{
+        name
+    }
+}
+`
+	assert := assert.New(t)
+	m, err := Marshal(&struct {
+		Count int          `json:"count"`
+		Root  childrenOnly `json:"root"`
+		Node  struct {
+			Name     string       `json:"name"`
+			Children childrenOnly `json:"children"`
+		} `json:"node"`
+	}{})
+	assert.NoError(err)
+	assert.Equal(realQ, m.String())
+
+	_, err = Marshal(&struct {
+		Root childrenOnly `json:"root"`
+	}{})
+	assert.EqualError(err, "every field was left out by the depth limit, the selection would be empty")
+}
+
+func TestRecursiveTypesFail(t *testing.T) {
+	assert := assert.New(t)
+	_, err := Marshal(&struct {
+		Root treeNode `json:"root"`
+	}{})
+	assert.EqualError(err, `Root.Children: graphql.treeNode is recursive, limit how deep it is unrolled with gql:"depth=N" or Marshaler.MaxDepth`)
+}
+
+func TestMaxDepthUnrollsRecursiveTypes(t *testing.T) {
+	realQ := `{
+    root{
+        name
+        children{
+            name
+            children{
+                name
+            }
+        }
+    }
+}
+`
+	assert := assert.New(t)
+	marshaler := NewMarshaler()
+	marshaler.MaxDepth = 3
+	_, err := marshaler.MarshalToGraphql(&struct {
+		Root treeNode `json:"root"`
+	}{})
+	assert.NoError(err)
+	assert.Equal(realQ, marshaler.String())
+}
+
+func TestDepthTag(t *testing.T) {
+	realQ := `{
+    node{
+        name
+        parent{
+            name
+            children{
+                name
+            }
+        }
+        children{
+            name
+            children{
+                name
+            }
+        }
+    }
+}
+`
+	assert := assert.New(t)
+	m, err := Marshal(&struct {
+		Node limitedNode `json:"node"`
+	}{})
+	assert.NoError(err)
+	assert.Equal(realQ, m.String())
+
+	_, err = Marshal(&struct {
+		Node struct {
+			Self []treeNode `json:"self" gql:"depth=x"`
+		} `json:"node"`
+	}{})
+	assert.EqualError(err, `Node.Self: "depth=x" should set the depth to a positive number`)
+}
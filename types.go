@@ -0,0 +1,105 @@
+package graphql
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// GqlTyper names the graphql type of a go type, e.g. an input object or a custom scalar. It is used to infer the
+// type of variables set with WithVariable that are declared in gql_params without a type.
+type GqlTyper interface {
+	GqlType() string
+}
+
+// ID is a string sent as a graphql ID
+type ID string
+
+// GqlType returns ID
+func (ID) GqlType() string {
+	return "ID"
+}
+
+var typerType = reflect.TypeOf(new(GqlTyper)).Elem()
+
+// registeredTypes maps go types to the graphql type registered for them with RegisterType
+var registeredTypes = sync.Map{}
+
+// RegisterType makes variables with the go type of sample be declared as graphqlType when their type is inferred.
+// graphqlType is the name of the type, e.g. DateTime: a value of the go type is declared as DateTime! and a pointer
+// to it as DateTime. It takes precedence over GqlTyper and the built in types.
+func RegisterType(sample interface{}, graphqlType string) {
+	tp := reflect.TypeOf(sample)
+	for tp != nil && tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+	registeredTypes.Store(tp, graphqlType)
+}
+
+// inferType returns the graphql type of a variable from its go value. Values are non null, pointers are nullable:
+// string is String!, *string is String, []int is [Int!]! and structs use the name of their go type.
+func inferType(value interface{}) (string, error) {
+	if value == nil {
+		return "", fmt.Errorf("cannot infer the graphql type of nil")
+	}
+	return inferGoType(reflect.TypeOf(value))
+}
+
+func inferGoType(tp reflect.Type) (string, error) {
+	if tp.Kind() == reflect.Ptr {
+		inner, err := inferGoType(tp.Elem())
+		return strings.TrimSuffix(inner, "!"), err
+	}
+	name, err := namedType(tp)
+	if err != nil {
+		return "", err
+	}
+	return name + "!", nil
+}
+
+// namedType returns the graphql type of tp without its nullability
+func namedType(tp reflect.Type) (string, error) {
+	if registered, ok := registeredTypes.Load(tp); ok {
+		return registered.(string), nil
+	}
+	if reflect.PtrTo(tp).Implements(typerType) {
+		return reflect.New(tp).Interface().(GqlTyper).GqlType(), nil
+	}
+	switch tp.Kind() {
+	case reflect.String:
+		return "String", nil
+	case reflect.Bool:
+		return "Boolean", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "Int", nil
+	case reflect.Float32, reflect.Float64:
+		return "Float", nil
+	case reflect.Slice, reflect.Array:
+		if tp.Elem().Kind() == reflect.Uint8 {
+			return "String", nil
+		}
+		inner, err := inferGoType(tp.Elem())
+		if err != nil {
+			return "", err
+		}
+		return "[" + inner + "]", nil
+	case reflect.Struct:
+		if tp.Name() != "" {
+			return tp.Name(), nil
+		}
+	}
+	return "", fmt.Errorf("cannot infer the graphql type of %s, implement GqlTyper or use RegisterType", tp)
+}
+
+// inferTypes infers the types of the variables that can be inferred
+func inferTypes(values map[string]interface{}) map[string]string {
+	types := map[string]string{}
+	for name, value := range values {
+		if tp, err := inferType(value); err == nil {
+			types[name] = tp
+		}
+	}
+	return types
+}
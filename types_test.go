@@ -0,0 +1,96 @@
+package graphql
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type UserInput struct {
+	Name string `json:"name"`
+}
+
+type episode string
+
+func (*episode) GqlType() string {
+	return "Episode"
+}
+
+type timestamp struct {
+	time.Time
+}
+
+func TestInferType(t *testing.T) {
+	assert := assert.New(t)
+	str := "a"
+	number := 1
+	cases := []struct {
+		value    interface{}
+		expected string
+	}{
+		{"a", "String!"},
+		{&str, "String"},
+		{1, "Int!"},
+		{&number, "Int"},
+		{uint8(1), "Int!"},
+		{1.5, "Float!"},
+		{true, "Boolean!"},
+		{[]string{"a"}, "[String!]!"},
+		{[]*int{}, "[Int]!"},
+		{&[][]bool{}, "[[Boolean!]!]"},
+		{[]byte("a"), "String!"},
+		{ID("1"), "ID!"},
+		{[]ID{}, "[ID!]!"},
+		{episode("NEWHOPE"), "Episode!"},
+		{UserInput{}, "UserInput!"},
+		{&UserInput{}, "UserInput"},
+		{Upload{}, "Upload!"},
+	}
+	for _, c := range cases {
+		tp, err := inferType(c.value)
+		assert.NoError(err)
+		assert.Equal(c.expected, tp, "%#v", c.value)
+	}
+}
+
+func TestCannotInferType(t *testing.T) {
+	assert := assert.New(t)
+	_, err := inferType(nil)
+	assert.Error(err)
+	_, err = inferType(map[string]string{})
+	assert.EqualError(err, "cannot infer the graphql type of map[string]string, implement GqlTyper or use RegisterType")
+	_, err = inferType(struct{}{})
+	assert.Error(err)
+	_, err = inferType([]interface{}{"a"})
+	assert.Error(err)
+}
+
+func TestRegisterType(t *testing.T) {
+	assert := assert.New(t)
+	RegisterType(&timestamp{}, "DateTime")
+	tp, err := inferType(timestamp{})
+	assert.NoError(err)
+	assert.Equal("DateTime!", tp)
+	tp, err = inferType([]*timestamp{})
+	assert.NoError(err)
+	assert.Equal("[DateTime]!", tp)
+}
+
+func TestDeclaresInferredTypes(t *testing.T) {
+	assert := assert.New(t)
+	query := newReq().Query(&struct {
+		Users []struct {
+			Name string `json:"name"`
+		} `json:"users" gql_params:"ids, first, input, explicit:Long, unknown"`
+	}{}).
+		WithVariable("ids", []ID{"1"}).
+		WithVariable("first", 10).
+		WithVariable("input", &UserInput{}).
+		WithVariable("explicit", 1).
+		WithVariable("unknown", map[string]string{}).
+		GetQuery()
+	assert.True(strings.HasPrefix(query, "query($ids:[ID!]!, $first:Int!, $input:UserInput, $explicit:Long){"), query)
+	assert.Contains(query, "users(ids:$ids, first:$first, input:$input, explicit:$explicit, unknown:$unknown){")
+}
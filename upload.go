@@ -0,0 +1,211 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Upload is a file that can be passed as a variable, or anywhere inside of a variable, with WithVariable. When a
+// request has uploads, the SimpleHTTPTransport sends it following the GraphQL multipart request spec and streams
+// the files from their readers. The readers are not closed by the transport. A RetryTransport only retries a
+// request with uploads when every reader implements io.Seeker, like *os.File does, the readers are sought back to
+// where they were before the request was first sent.
+type Upload struct {
+	// File is read when the request is sent
+	File io.Reader
+	// FileName is the name of the file sent to the api
+	FileName string
+	// ContentType is the content type of the file, it defaults to application/octet-stream
+	ContentType string
+}
+
+// MarshalJSON marshals the upload to null, the multipart request spec has the files take the place of the nulls
+// in the variables
+func (u Upload) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+// GqlType returns Upload, the scalar the multipart request spec uses for files
+func (u Upload) GqlType() string {
+	return "Upload"
+}
+
+var uploadType = reflect.TypeOf(Upload{})
+
+// uploadRewinder remembers where the readers of the uploads of a request were before it was sent, so they can be
+// put back there to send the request again
+type uploadRewinder struct {
+	seekers []io.Seeker
+	offsets []int64
+	// canRewind is false when a reader does not implement io.Seeker or its position can't be read
+	canRewind bool
+}
+
+func newUploadRewinder(variables map[string]interface{}) *uploadRewinder {
+	rewinder := &uploadRewinder{canRewind: true}
+	for _, ref := range collectUploads(variables) {
+		seeker, ok := ref.upload.File.(io.Seeker)
+		if !ok {
+			rewinder.canRewind = false
+			return rewinder
+		}
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			rewinder.canRewind = false
+			return rewinder
+		}
+		rewinder.seekers = append(rewinder.seekers, seeker)
+		rewinder.offsets = append(rewinder.offsets, offset)
+	}
+	return rewinder
+}
+
+// rewind puts the readers back where they were when the rewinder was made
+func (u *uploadRewinder) rewind() error {
+	for i, seeker := range u.seekers {
+		if _, err := seeker.Seek(u.offsets[i], io.SeekStart); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadRef is an upload found in the variables of a request and the path the api should put it at
+type uploadRef struct {
+	path   string
+	upload Upload
+}
+
+// collectUploads finds every upload in the variables. The paths are in the object path form the multipart request
+// spec uses, e.g. variables.input.files.0
+func collectUploads(variables map[string]interface{}) []uploadRef {
+	uploads := []uploadRef{}
+	walkUploads(reflect.ValueOf(variables), "variables", &uploads)
+	return uploads
+}
+
+func walkUploads(val reflect.Value, path string, uploads *[]uploadRef) {
+	if !val.IsValid() {
+		return
+	}
+	switch val.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if !val.IsNil() {
+			walkUploads(val.Elem(), path, uploads)
+		}
+	case reflect.Struct:
+		if val.Type() == uploadType {
+			*uploads = append(*uploads, uploadRef{path: path, upload: val.Interface().(Upload)})
+			return
+		}
+		tp := val.Type()
+		for i := 0; i < tp.NumField(); i++ {
+			field := tp.Field(i)
+			if field.PkgPath != "" && !field.Anonymous {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" && field.Anonymous {
+				walkUploads(val.Field(i), path, uploads)
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			walkUploads(val.Field(i), path+"."+name, uploads)
+		}
+	case reflect.Map:
+		keys := val.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			walkUploads(val.MapIndex(key), fmt.Sprintf("%s.%v", path, key.Interface()), uploads)
+		}
+	case reflect.Slice, reflect.Array:
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for i := 0; i < val.Len(); i++ {
+			walkUploads(val.Index(i), path+"."+strconv.Itoa(i), uploads)
+		}
+	}
+}
+
+// sendMultipart sends the request as a multipart form with an operations field, a map field and a part for every
+// file. The body is written while it is sent so files are never fully held in memory.
+func (s *SimpleHTTPTransport) sendMultipart(ctx context.Context, req Request, body graphqlRequest, uploads []uploadRef) (Response, error) {
+	operations, err := json.Marshal(body)
+	if err != nil {
+		return Response{}, err
+	}
+	fileMap := map[string][]string{}
+	for i, upload := range uploads {
+		fileMap[strconv.Itoa(i)] = []string{upload.path}
+	}
+	fileMapBts, err := json.Marshal(fileMap)
+	if err != nil {
+		return Response{}, err
+	}
+	reader, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", s.apiURL, reader)
+	if err != nil {
+		return Response{}, err
+	}
+	addHeaders(httpReq, s.headers)
+	httpReq.Header.Set("Content-Type", form.FormDataContentType())
+	go func() {
+		writer.CloseWithError(writeMultipart(form, operations, fileMapBts, uploads))
+	}()
+	return s.do(req, httpReq)
+}
+
+func writeMultipart(form *multipart.Writer, operations []byte, fileMap []byte, uploads []uploadRef) error {
+	if err := form.WriteField("operations", string(operations)); err != nil {
+		return err
+	}
+	if err := form.WriteField("map", string(fileMap)); err != nil {
+		return err
+	}
+	for i, upload := range uploads {
+		contentType := upload.upload.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(
+			`form-data; name="%d"; filename="%s"`, i, escapeQuotes(upload.upload.FileName),
+		))
+		header.Set("Content-Type", contentType)
+		part, err := form.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if upload.upload.File == nil {
+			continue
+		}
+		if _, err := io.Copy(part, upload.upload.File); err != nil {
+			return err
+		}
+	}
+	return form.Close()
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
@@ -0,0 +1,214 @@
+package graphql
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type uploadInput struct {
+	Name   string    `json:"name"`
+	Avatar *Upload   `json:"avatar"`
+	Files  []Upload  `json:"files"`
+	Skip   Upload    `json:"-"`
+	Tags   []string  `json:"tags"`
+	Raw    []byte    `json:"raw"`
+	Nested *struct{} `json:"nested"`
+}
+
+func TestCollectUploads(t *testing.T) {
+	assert := assert.New(t)
+	avatar := &Upload{FileName: "avatar.png"}
+	uploads := collectUploads(map[string]interface{}{
+		"file": Upload{FileName: "one.txt"},
+		"input": uploadInput{
+			Name:   "name",
+			Avatar: avatar,
+			Files:  []Upload{{FileName: "a"}, {FileName: "b"}},
+			Skip:   Upload{FileName: "skipped"},
+		},
+		"list": []interface{}{"x", map[string]interface{}{"doc": Upload{FileName: "doc"}}},
+		"none": nil,
+	})
+	paths := []string{}
+	names := []string{}
+	for _, upload := range uploads {
+		paths = append(paths, upload.path)
+		names = append(names, upload.upload.FileName)
+	}
+	assert.Equal([]string{
+		"variables.file",
+		"variables.input.avatar",
+		"variables.input.files.0",
+		"variables.input.files.1",
+		"variables.list.1.doc",
+	}, paths)
+	assert.Equal([]string{"one.txt", "avatar.png", "a", "b", "doc"}, names)
+	assert.Empty(collectUploads(map[string]interface{}{"id": "1"}))
+}
+
+func TestUploadMarshalsToNull(t *testing.T) {
+	assert := assert.New(t)
+	bts, err := json.Marshal(uploadInput{Avatar: &Upload{}, Files: []Upload{{}}})
+	assert.NoError(err)
+	assert.JSONEq(`{"name":"","avatar":null,"files":[null],"tags":null,"raw":null,"nested":null}`, string(bts))
+}
+
+type uploadMutation struct {
+	Upload struct {
+		ID string `json:"id"`
+	} `json:"upload" gql_params:"file:Upload!,input:UploadInput"`
+}
+
+func TestSendsMultipartRequest(t *testing.T) {
+	assert := assert.New(t)
+	wasCalled := false
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		wasCalled = true
+		assert.True(strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data; boundary="))
+		assert.Equal("secret", req.Header.Get("Authorization"))
+		reader, err := req.MultipartReader()
+		assert.NoError(err)
+
+		part, _ := reader.NextPart()
+		assert.Equal("operations", part.FormName())
+		operations := graphqlRequest{}
+		assert.NoError(json.NewDecoder(part).Decode(&operations))
+		assert.Contains(operations.Query, "file:$file")
+		assert.Contains(operations.Query, "input:$input")
+		assert.Nil(operations.Variables["file"])
+		assert.Equal(map[string]interface{}{"name": "docs", "files": []interface{}{nil}}, operations.Variables["input"])
+
+		part, _ = reader.NextPart()
+		assert.Equal("map", part.FormName())
+		bts, _ := ioutil.ReadAll(part)
+		assert.JSONEq(`{"0":["variables.file"],"1":["variables.input.files.0"]}`, string(bts))
+
+		part, _ = reader.NextPart()
+		assert.Equal("0", part.FormName())
+		assert.Equal("a.txt", part.FileName())
+		assert.Equal("text/plain", part.Header.Get("Content-Type"))
+		bts, _ = ioutil.ReadAll(part)
+		assert.Equal("hello", string(bts))
+
+		part, _ = reader.NextPart()
+		assert.Equal("1", part.FormName())
+		assert.Equal(`b "quoted".bin`, part.FileName())
+		assert.Equal("application/octet-stream", part.Header.Get("Content-Type"))
+		bts, _ = ioutil.ReadAll(part)
+		assert.Equal("world", string(bts))
+
+		_, err = reader.NextPart()
+		assert.Equal(io.EOF, err)
+		rw.Write([]byte(`{"data":{"upload":{"id":"1"}}}`))
+	}))
+	defer server.Close()
+
+	type input struct {
+		Name  string   `json:"name"`
+		Files []Upload `json:"files"`
+	}
+	msg := &uploadMutation{}
+	transport := NewSimpleHTTPTransport(server.URL, WithHeader("Authorization", "secret"))
+	_, err := NewClient(transport).NewRequest().
+		Mutation(msg).
+		WithVariable("file", Upload{File: strings.NewReader("hello"), FileName: "a.txt", ContentType: "text/plain"}).
+		WithVariable("input", input{
+			Name:  "docs",
+			Files: []Upload{{File: strings.NewReader("world"), FileName: `b "quoted".bin`}},
+		}).
+		Send()
+	assert.NoError(err)
+	assert.True(wasCalled)
+	assert.Equal("1", msg.Upload.ID)
+}
+
+func TestBatchSendsUploadsOnTheirOwn(t *testing.T) {
+	assert := assert.New(t)
+	files := []string{}
+	batched := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data") {
+			bodies := []graphqlRequest{}
+			assert.NoError(json.NewDecoder(req.Body).Decode(&bodies))
+			batched += len(bodies)
+			rw.Write([]byte(`[{"data":{"message":"batched"}}]`))
+			return
+		}
+		reader, err := req.MultipartReader()
+		assert.NoError(err)
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			if part.FileName() != "" {
+				bts, _ := ioutil.ReadAll(part)
+				files = append(files, string(bts))
+			}
+		}
+		rw.Write([]byte(`{"data":{"upload":{"id":"1"}}}`))
+	}))
+	defer server.Close()
+
+	c := NewClient(NewSimpleHTTPTransport(server.URL))
+	msg, upload := &batchQuery{}, &uploadMutation{}
+	results, err := c.Batch(
+		c.NewRequest().Query(msg).WithVariable("name", "one"),
+		c.NewRequest().Mutation(upload).WithVariable("file", Upload{File: strings.NewReader("hello"), FileName: "a.txt"}),
+	)
+	assert.NoError(err)
+	assert.NoError(results[0].Err)
+	assert.NoError(results[1].Err)
+	assert.Equal(1, batched)
+	assert.Equal([]string{"hello"}, files)
+	assert.Equal("batched", msg.Message)
+	assert.Equal("1", upload.Upload.ID)
+}
+
+func TestRetryRewindsUploads(t *testing.T) {
+	assert := assert.New(t)
+	files := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reader, err := req.MultipartReader()
+		assert.NoError(err)
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			if part.FileName() != "" {
+				bts, _ := ioutil.ReadAll(part)
+				files = append(files, string(bts))
+			}
+		}
+		if len(files) == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.Write([]byte(`{"data":{"upload":{"id":"1"}}}`))
+	}))
+	defer server.Close()
+
+	c := NewClient(NewSimpleHTTPTransport(server.URL)).Use(Retry(RetryMutations(), RetryBackoff(time.Millisecond, time.Millisecond)))
+	file := strings.NewReader("hello")
+	_, err := c.NewRequest().Mutation(&uploadMutation{}).WithVariable("file", Upload{File: file, FileName: "a.txt"}).Send()
+	assert.NoError(err)
+	assert.Equal([]string{"hello", "hello"}, files)
+
+	files = nil
+	notSeekable := struct{ io.Reader }{strings.NewReader("hello")}
+	_, err = c.NewRequest().Mutation(&uploadMutation{}).WithVariable("file", Upload{File: notSeekable, FileName: "a.txt"}).Send()
+	statusErr := &StatusError{}
+	assert.True(errors.As(err, &statusErr))
+	assert.Equal(http.StatusServiceUnavailable, statusErr.StatusCode)
+	assert.Equal([]string{"hello"}, files)
+}
@@ -32,3 +32,12 @@ func (s *set) elements() []string {
 	}
 	return elems
 }
+
+func containsString(values []string, value string) bool {
+	for _, elem := range values {
+		if elem == value {
+			return true
+		}
+	}
+	return false
+}
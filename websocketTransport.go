@@ -0,0 +1,293 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// ProtocolGraphqlTransportWS is the graphql-transport-ws subprotocol spoken by the graphql-ws library
+	ProtocolGraphqlTransportWS = "graphql-transport-ws"
+	// ProtocolGraphqlWS is the legacy graphql-ws subprotocol spoken by subscriptions-transport-ws
+	ProtocolGraphqlWS = "graphql-ws"
+)
+
+const defaultAckTimeout = 10 * time.Second
+
+var errStopSubscription = errors.New("graphql: subscription stopped")
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// WebSocketTransport sends requests over a websocket. It implements SubscriptionTransport so it can be used
+// for subscriptions, queries and mutations sent through it return the first result the server sends.
+// Each operation opens its own connection.
+type WebSocketTransport struct {
+	apiURL           string
+	headers          http.Header
+	protocols        []string
+	connectionParams interface{}
+	ackTimeout       time.Duration
+	dialer           *websocket.Dialer
+}
+
+// NewWebSocketTransport takes the websocket URL of the api (ws:// or wss://) and returns a WebSocketTransport.
+// Both the graphql-transport-ws and the legacy graphql-ws protocols are offered to the server, the one the
+// server picks is used.
+func NewWebSocketTransport(apiURL string) *WebSocketTransport {
+	return &WebSocketTransport{
+		apiURL:     apiURL,
+		headers:    http.Header{},
+		protocols:  []string{ProtocolGraphqlTransportWS, ProtocolGraphqlWS},
+		ackTimeout: defaultAckTimeout,
+		dialer:     websocket.DefaultDialer,
+	}
+}
+
+// AddHeader adds a header onto the websocket handshake request
+func (w *WebSocketTransport) AddHeader(name string, value string) {
+	w.headers.Add(name, value)
+}
+
+// SetProtocols sets the subprotocols offered to the server in order of preference. If the server does not
+// pick one, the first is used.
+func (w *WebSocketTransport) SetProtocols(protocols ...string) {
+	w.protocols = protocols
+}
+
+// SetConnectionParams sets the payload of the connection_init message, servers commonly use it for auth
+func (w *WebSocketTransport) SetConnectionParams(params interface{}) {
+	w.connectionParams = params
+}
+
+// SetAckTimeout sets how long to wait for the server to acknowledge the connection
+func (w *WebSocketTransport) SetAckTimeout(timeout time.Duration) {
+	w.ackTimeout = timeout
+}
+
+// Transport sends the request over a websocket and returns the first result
+func (w *WebSocketTransport) Transport(req Request) (Response, error) {
+	return w.TransportContext(context.Background(), req)
+}
+
+// TransportContext sends the request over a websocket and returns the first result. The result is decoded into
+// the object the request was built with.
+func (w *WebSocketTransport) TransportContext(ctx context.Context, req Request) (Response, error) {
+	var response Response
+	var respErr error
+	received := false
+	err := w.subscribe(ctx, req, req.GetInterface, func(resp Response, err error) error {
+		response, respErr, received = resp, err, true
+		return errStopSubscription
+	})
+	if err != nil && err != errStopSubscription {
+		return response, err
+	}
+	if !received {
+		return response, errors.New("graphql: operation completed without a result")
+	}
+	return response, respErr
+}
+
+// Subscribe starts the subscription and calls handler with every result until the server completes it
+func (w *WebSocketTransport) Subscribe(ctx context.Context, req Request, handler SubscriptionHandler) error {
+	return w.subscribe(ctx, req, func() interface{} { return newResponseObject(req) }, handler)
+}
+
+func (w *WebSocketTransport) subscribe(ctx context.Context, req Request, newObj func() interface{}, handler SubscriptionHandler) error {
+	dialer := *w.dialer
+	dialer.Subprotocols = w.protocols
+	headers := w.headers.Clone()
+	for key, values := range headersFromContext(ctx) {
+		for _, value := range values {
+			headers.Add(key, value)
+		}
+	}
+	conn, httpResp, err := dialer.DialContext(ctx, w.apiURL, headers)
+	if err != nil {
+		return err
+	}
+	protocol := conn.Subprotocol()
+	if protocol == "" && len(w.protocols) > 0 {
+		protocol = w.protocols[0]
+	}
+	session := &wsSession{conn: conn, protocol: protocol, id: "1"}
+	defer session.close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.stop()
+			session.close()
+		case <-done:
+		}
+	}()
+
+	err = session.run(w.connectionParams, w.ackTimeout, newGraphqlRequest(req), func(payload json.RawMessage, opErr error) error {
+		response := Response{
+			HttpResponse: httpResp,
+			Payload:      payload,
+		}
+		if opErr != nil {
+			response.Errors, _ = opErr.(Errors)
+			return handler(response, opErr)
+		}
+		return handler(response, response.decode(payload, newObj()))
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// wsSession runs a single operation over a websocket connection
+type wsSession struct {
+	conn      *websocket.Conn
+	protocol  string
+	id        string
+	writeLock sync.Mutex
+	closeOnce sync.Once
+}
+
+func (s *wsSession) write(msg wsMessage) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	return s.conn.WriteJSON(msg)
+}
+
+func (s *wsSession) read() (wsMessage, error) {
+	msg := wsMessage{}
+	err := s.conn.ReadJSON(&msg)
+	return msg, err
+}
+
+func (s *wsSession) init(params interface{}, ackTimeout time.Duration) error {
+	initMsg := wsMessage{Type: "connection_init"}
+	if params != nil {
+		payload, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		initMsg.Payload = payload
+	}
+	if err := s.write(initMsg); err != nil {
+		return err
+	}
+	s.conn.SetReadDeadline(time.Now().Add(ackTimeout))
+	defer s.conn.SetReadDeadline(time.Time{})
+	for {
+		msg, err := s.read()
+		if err != nil {
+			return err
+		}
+		switch msg.Type {
+		case "connection_ack":
+			return nil
+		case "ping":
+			if err := s.write(wsMessage{Type: "pong", Payload: msg.Payload}); err != nil {
+				return err
+			}
+		case "ka", "pong":
+		case "connection_error":
+			return wsPayloadError(msg.Payload)
+		default:
+			return fmt.Errorf("graphql: unexpected message %q before connection_ack", msg.Type)
+		}
+	}
+}
+
+func (s *wsSession) run(params interface{}, ackTimeout time.Duration, body graphqlRequest, onResult func(json.RawMessage, error) error) error {
+	if err := s.init(params, ackTimeout); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	startType := "subscribe"
+	if s.protocol == ProtocolGraphqlWS {
+		startType = "start"
+	}
+	if err := s.write(wsMessage{ID: s.id, Type: startType, Payload: payload}); err != nil {
+		return err
+	}
+	for {
+		msg, err := s.read()
+		if err != nil {
+			return err
+		}
+		if msg.ID != "" && msg.ID != s.id {
+			continue
+		}
+		switch msg.Type {
+		case "next", "data":
+			if err := onResult(msg.Payload, nil); err != nil {
+				s.stop()
+				return err
+			}
+		case "error":
+			opErr := wsPayloadError(msg.Payload)
+			if err := onResult(msg.Payload, opErr); err != nil {
+				return err
+			}
+			return opErr
+		case "complete":
+			return nil
+		case "ping":
+			if err := s.write(wsMessage{Type: "pong", Payload: msg.Payload}); err != nil {
+				return err
+			}
+		case "connection_error":
+			return wsPayloadError(msg.Payload)
+		}
+	}
+}
+
+// stop tells the server the client is no longer interested in the operation
+func (s *wsSession) stop() {
+	if s.protocol == ProtocolGraphqlWS {
+		s.write(wsMessage{ID: s.id, Type: "stop"})
+		s.write(wsMessage{Type: "connection_terminate"})
+		return
+	}
+	s.write(wsMessage{ID: s.id, Type: "complete"})
+}
+
+func (s *wsSession) close() {
+	s.closeOnce.Do(func() {
+		s.writeLock.Lock()
+		s.conn.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+			time.Now().Add(time.Second),
+		)
+		s.writeLock.Unlock()
+		s.conn.Close()
+	})
+}
+
+// wsPayloadError converts the payload of an error message to an error. graphql-transport-ws sends a list of
+// graphql errors where the legacy protocol sends a single error object.
+func wsPayloadError(payload json.RawMessage) error {
+	errs := Errors{}
+	if err := json.Unmarshal(payload, &errs); err == nil && len(errs) > 0 {
+		return errs
+	}
+	single := Error{}
+	if err := json.Unmarshal(payload, &single); err == nil && single.Message != "" {
+		return Errors{single}
+	}
+	return fmt.Errorf("graphql: %s", string(payload))
+}
@@ -0,0 +1,225 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSubscription struct {
+	MessageAdded struct {
+		Text string `json:"text"`
+	} `json:"messageAdded" gql_params:"room:String"`
+}
+
+type wsServerState struct {
+	protocol  string
+	initMsg   wsMessage
+	startMsg  wsMessage
+	stopped   chan string
+	sendPing  bool
+	results   []string
+	errResult string
+	hang      bool
+}
+
+func newWsServer(t *testing.T, state *wsServerState, protocols ...string) *httptest.Server {
+	upgrader := websocket.Upgrader{Subprotocols: protocols}
+	state.stopped = make(chan string, 4)
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(rw, req, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		state.protocol = conn.Subprotocol()
+		conn.ReadJSON(&state.initMsg)
+		if state.sendPing {
+			conn.WriteJSON(wsMessage{Type: "ping"})
+			pong := wsMessage{}
+			conn.ReadJSON(&pong)
+			assert.Equal(t, "pong", pong.Type)
+		}
+		conn.WriteJSON(wsMessage{Type: "connection_ack"})
+		conn.ReadJSON(&state.startMsg)
+		nextType := "next"
+		if state.protocol == ProtocolGraphqlWS {
+			nextType = "data"
+			conn.WriteJSON(wsMessage{Type: "ka"})
+		}
+		for _, result := range state.results {
+			conn.WriteJSON(wsMessage{ID: state.startMsg.ID, Type: nextType, Payload: json.RawMessage(result)})
+		}
+		if state.errResult != "" {
+			conn.WriteJSON(wsMessage{ID: state.startMsg.ID, Type: "error", Payload: json.RawMessage(state.errResult)})
+			return
+		}
+		if state.hang {
+			for {
+				msg := wsMessage{}
+				if err := conn.ReadJSON(&msg); err != nil {
+					return
+				}
+				state.stopped <- msg.Type
+			}
+		}
+		conn.WriteJSON(wsMessage{ID: state.startMsg.ID, Type: "complete"})
+		for {
+			msg := wsMessage{}
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func wsURL(server *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestWebSocketSubscription(t *testing.T) {
+	for _, protocol := range []string{ProtocolGraphqlTransportWS, ProtocolGraphqlWS} {
+		t.Run(protocol, func(t *testing.T) {
+			assert := assert.New(t)
+			state := &wsServerState{
+				sendPing: protocol == ProtocolGraphqlTransportWS,
+				results: []string{
+					`{"data":{"messageAdded":{"text":"one"}}}`,
+					`{"data":{"messageAdded":{"text":"two"}}}`,
+				},
+			}
+			server := newWsServer(t, state, protocol)
+			defer server.Close()
+			transport := NewWebSocketTransport(wsURL(server))
+			transport.SetConnectionParams(map[string]string{"token": "secret"})
+			sub := &testSubscription{}
+			req := newReq().Subscription(sub).WithVariable("room", "general").SetTransport(transport)
+
+			received := []*testSubscription{}
+			err := req.Subscribe(context.Background(), func(resp Response, err error) error {
+				assert.NoError(err)
+				received = append(received, resp.Response.(*testSubscription))
+				return nil
+			})
+			assert.NoError(err)
+			assert.Equal(protocol, state.protocol)
+			assert.Equal("connection_init", state.initMsg.Type)
+			assert.JSONEq(`{"token":"secret"}`, string(state.initMsg.Payload))
+			if protocol == ProtocolGraphqlWS {
+				assert.Equal("start", state.startMsg.Type)
+			} else {
+				assert.Equal("subscribe", state.startMsg.Type)
+			}
+			body := graphqlRequest{}
+			assert.NoError(json.Unmarshal(state.startMsg.Payload, &body))
+			assert.Equal(noSpaces(`subscription($room:String){
+				messageAdded(room:$room){
+					text
+				}
+			}
+			`), noSpaces(body.Query))
+			assert.Equal("general", body.Variables["room"])
+
+			assert.Len(received, 2)
+			assert.Equal("one", received[0].MessageAdded.Text)
+			assert.Equal("two", received[1].MessageAdded.Text)
+			assert.True(received[0] != received[1])
+			assert.True(received[0] != sub)
+			assert.Empty(sub.MessageAdded.Text)
+		})
+	}
+}
+
+func TestWebSocketSubscriptionError(t *testing.T) {
+	assert := assert.New(t)
+	state := &wsServerState{errResult: `[{"message":"not allowed"}]`}
+	server := newWsServer(t, state, ProtocolGraphqlTransportWS)
+	defer server.Close()
+	transport := NewWebSocketTransport(wsURL(server))
+	req := newReq().Subscription(&testSubscription{}).SetTransport(transport)
+	calls := 0
+	err := req.Subscribe(context.Background(), func(resp Response, err error) error {
+		calls++
+		assert.Error(err)
+		return nil
+	})
+	assert.Equal(1, calls)
+	assert.EqualError(err, "graphql: not allowed")
+}
+
+func TestWebSocketSubscriptionCancel(t *testing.T) {
+	assert := assert.New(t)
+	state := &wsServerState{
+		results: []string{`{"data":{"messageAdded":{"text":"one"}}}`},
+		hang:    true,
+	}
+	server := newWsServer(t, state, ProtocolGraphqlTransportWS)
+	defer server.Close()
+	transport := NewWebSocketTransport(wsURL(server))
+	req := newReq().Subscription(&testSubscription{}).SetTransport(transport)
+	ctx, cancel := context.WithCancel(context.Background())
+	err := req.Subscribe(ctx, func(resp Response, err error) error {
+		cancel()
+		return nil
+	})
+	assert.Equal(context.Canceled, err)
+	select {
+	case msgType := <-state.stopped:
+		assert.Equal("complete", msgType)
+	case <-time.After(time.Second):
+		t.Error("server was not told to stop the subscription")
+	}
+}
+
+func TestWebSocketHandlerCanStop(t *testing.T) {
+	assert := assert.New(t)
+	state := &wsServerState{
+		results: []string{
+			`{"data":{"messageAdded":{"text":"one"}}}`,
+			`{"data":{"messageAdded":{"text":"two"}}}`,
+		},
+		hang: true,
+	}
+	server := newWsServer(t, state, ProtocolGraphqlWS)
+	defer server.Close()
+	transport := NewWebSocketTransport(wsURL(server))
+	req := newReq().Subscription(&testSubscription{}).SetTransport(transport)
+	calls := 0
+	err := req.Subscribe(context.Background(), func(resp Response, err error) error {
+		calls++
+		return errStopSubscription
+	})
+	assert.Equal(errStopSubscription, err)
+	assert.Equal(1, calls)
+	assert.Equal("stop", <-state.stopped)
+}
+
+func TestWebSocketTransportReturnsFirstResult(t *testing.T) {
+	assert := assert.New(t)
+	state := &wsServerState{
+		results: []string{`{"data":{"message":"Good","sub_query":{"message":"Great"}}}`},
+	}
+	server := newWsServer(t, state, ProtocolGraphqlTransportWS)
+	defer server.Close()
+	msg := &testQuery{}
+	resp, err := NewClient(NewWebSocketTransport(wsURL(server))).NewRequest().Query(msg).Send()
+	assert.NoError(err)
+	assert.Equal("Good", msg.Message)
+	assert.Equal("Great", msg.SubQ.SubMessage)
+	assert.Equal(msg, resp.Response)
+}
+
+func TestSubscribeWithoutSubscriptionTransport(t *testing.T) {
+	assert := assert.New(t)
+	req := newReq().Subscription(&testSubscription{}).SetTransport(&mockTransport{})
+	err := req.Subscribe(context.Background(), func(resp Response, err error) error { return nil })
+	assert.Equal(ErrSubscriptionsNotSupported, err)
+}